@@ -0,0 +1,42 @@
+package main
+
+import (
+	"cavalier/pkg/backup"
+	"cavalier/pkg/vars"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// takes a consistent backup of a running (or stopped) cavalier instance.
+// run it from cavalier's working directory.
+
+func main() {
+	out := flag.String("o", backup.DefaultArchiveName(), "archive to write")
+	flag.Parse()
+
+	// the database paths can be changed in the config
+	if err := vars.Init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	userDB, err := vars.OpenDB(vars.UserDBPath)
+	if err != nil {
+		fmt.Println("Failed to open user database:", err)
+		os.Exit(1)
+	}
+	defer userDB.Close()
+	jdocsDB, err := vars.OpenDB(vars.JdocsDBPath)
+	if err != nil {
+		fmt.Println("Failed to open jdocs database:", err)
+		os.Exit(1)
+	}
+	defer jdocsDB.Close()
+
+	backup.Init(userDB, jdocsDB)
+	if err := backup.WriteArchiveFile(*out); err != nil {
+		fmt.Println("Backup failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Backup written to " + *out)
+}
@@ -0,0 +1,7 @@
+package main
+
+import "cavalier/pkg/cavalier"
+
+func main() {
+	cavalier.InitCavalier()
+}
@@ -0,0 +1,6 @@
+//go:build !novosk
+
+package main
+
+// build with -tags novosk to leave vosk out, when libvosk isn't installed
+import _ "cavalier/pkg/vosk"
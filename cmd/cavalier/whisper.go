@@ -0,0 +1,6 @@
+//go:build !nowhisper
+
+package main
+
+// build with -tags nowhisper to leave whisper.cpp out, when it isn't built
+import _ "cavalier/pkg/whisper"
@@ -0,0 +1,4 @@
+package main
+
+// needs no C libraries, so it's always built in
+import _ "cavalier/pkg/whisperapi"
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cavalier/pkg/recording"
+	"cavalier/pkg/vars"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exports opted-in voice recordings as a labelled dataset, for tuning intents and STT models.
+// run it from cavalier's working directory.
+//   go run ./cmd/recexport -o dataset -since 168h -intents intent_weather_extend,intent_system_unmatched
+
+func main() {
+	// the recordings directory can be changed in the config
+	if err := vars.Init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	out := flag.String("o", "dataset", "directory to write the dataset to")
+	dir := flag.String("recordings", vars.RecordingsPath, "recordings directory")
+	since := flag.Duration("since", 0, "only recordings newer than this (e.g. 168h), 0 for all")
+	intents := flag.String("intents", "", "comma-separated intents to export, empty for all")
+	esn := flag.String("esn", "", "only this robot")
+	withOgg := flag.Bool("ogg", false, "also copy the original Ogg Opus streams")
+	flag.Parse()
+
+	vars.RecordingsPath = *dir
+	opts := recording.ExportOptions{
+		ESN:     *esn,
+		WithOgg: *withOgg,
+	}
+	if *since > 0 {
+		opts.Since = time.Now().Add(-*since)
+	}
+	if *intents != "" {
+		opts.Intents = strings.Split(*intents, ",")
+	}
+
+	counts, err := recording.Export(*out, opts)
+	if err != nil {
+		fmt.Println("Export failed:", err)
+		os.Exit(1)
+	}
+	var names []string
+	total := 0
+	for intent, n := range counts {
+		names = append(names, intent)
+		total += n
+	}
+	sort.Strings(names)
+	for _, intent := range names {
+		label := intent
+		if label == "" {
+			label = "(none)"
+		}
+		fmt.Printf("%-40s %d\n", label, counts[intent])
+	}
+	fmt.Printf("Exported %d recordings to %s\n", total, *out)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"cavalier/pkg/backup"
+	"cavalier/pkg/vars"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// restores a backup made by cmd/backup or /admin/backup.
+// stop cavalier first, and run this from cavalier's working directory.
+
+func main() {
+	verifyOnly := flag.Bool("verify", false, "only check the archive, don't restore it")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("usage: restore [-verify] <backup.tar.gz>")
+		os.Exit(1)
+	}
+	archive := flag.Arg(0)
+
+	// the database paths can be changed in the config
+	if err := vars.Init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *verifyOnly {
+		dir, err := os.MkdirTemp("", "cavalier-verify-")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		if err := backup.Verify(archive, dir); err != nil {
+			fmt.Println(err)
+			os.RemoveAll(dir)
+			os.Exit(1)
+		}
+		fmt.Println("Backup is good")
+		return
+	}
+
+	if err := backup.Restore(archive); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Restore complete")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"cavalier/pkg/robotsim"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+// plays audio files to a chipper server as a fake robot.
+//   go run ./cmd/robotsim -addr localhost:8081 -insecure hello.wav
+//   go run ./cmd/robotsim -addr localhost:8081 -insecure -expect-intent intent_weather_extend weather.ogg
+//   go run ./cmd/robotsim -addr localhost:8081 -insecure fixtures/
+// a directory runs as a suite, see pkg/robotsim/suite.go for the fixture format.
+
+type paramFlags map[string]string
+
+func (p paramFlags) String() string { return fmt.Sprint(map[string]string(p)) }
+
+func (p paramFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	p[k] = v
+	return nil
+}
+
+func fail(msg string, err error) {
+	fmt.Println(msg+":", err)
+	os.Exit(1)
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "chipper address")
+	insecureSkip := flag.Bool("insecure", false, "don't verify the server's certificate")
+	caFile := flag.String("ca", "", "CA certificate to trust")
+	plaintext := flag.Bool("plaintext", false, "connect without TLS")
+	esn := flag.String("esn", "00e20100", "device ID to send")
+	lang := flag.String("lang", "en-US", "language to send")
+	mode := flag.String("mode", "VOICE_COMMAND", "robot mode (VOICE_COMMAND or GAME)")
+	rpc := flag.String("rpc", "intent_graph", "intent_graph, intent or knowledge_graph")
+	realtime := flag.Bool("realtime", false, "send audio at the speed a robot records it")
+	chunkMs := flag.Int("chunk-ms", 100, "PCM/WAV chunk size")
+	padMs := flag.Int("pad-ms", 1000, "silence after PCM/WAV audio, so end of speech is detected")
+	timeout := flag.Duration("timeout", 30*time.Second, "per request")
+	expectIntent := flag.String("expect-intent", "", "fail unless this intent comes back")
+	expectTranscript := flag.String("expect-transcript", "", "fail unless this is the transcript")
+	expectParams := paramFlags{}
+	flag.Var(expectParams, "expect-param", "fail unless this key=value param comes back (repeatable)")
+	jsonOut := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Println("usage: robotsim [flags] <audio file or fixture directory>")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	modeVal, ok := pb.RobotMode_value[strings.ToUpper(*mode)]
+	if !ok {
+		fail("Bad -mode", fmt.Errorf("unknown mode %s", *mode))
+	}
+
+	client, err := robotsim.Dial(robotsim.Config{
+		Addr:               *addr,
+		InsecureSkipVerify: *insecureSkip,
+		CAFile:             *caFile,
+		Plaintext:          *plaintext,
+		DeviceID:           *esn,
+		Language:           robotsim.LanguageCode(*lang),
+		Mode:               pb.RobotMode(modeVal),
+		Realtime:           *realtime,
+		Timeout:            *timeout,
+	})
+	if err != nil {
+		fail("Failed to connect", err)
+	}
+	defer client.Close()
+
+	target := flag.Arg(0)
+	info, err := os.Stat(target)
+	if err != nil {
+		fail("Failed to open "+target, err)
+	}
+	ctx := context.Background()
+
+	if info.IsDir() {
+		passed, failed, err := client.RunSuite(ctx, target, *rpc, *chunkMs, *padMs, os.Stdout)
+		if err != nil {
+			fail("Suite failed", err)
+		}
+		fmt.Printf("%d passed, %d failed\n", passed, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fixture := robotsim.Fixture{Name: info.Name(), Audio: target, Expect: &robotsim.Expect{
+		RPC:        *rpc,
+		Intent:     *expectIntent,
+		Params:     expectParams,
+		Transcript: *expectTranscript,
+	}}
+	res, runErr := client.Run(ctx, fixture, *rpc, *chunkMs, *padMs)
+	if *jsonOut {
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(out))
+	} else if res.RPC != "" {
+		fmt.Println("Intent:      " + res.Intent)
+		fmt.Printf("Params:      %v\n", res.Params)
+		fmt.Println("Transcript:  " + res.QueryText)
+		if res.SpokenText != "" {
+			fmt.Println("Spoken text: " + res.SpokenText)
+		}
+		if res.CommandType != "" {
+			fmt.Println("Command:     " + res.CommandType)
+		}
+		fmt.Println("Took:        " + res.Duration.Round(time.Millisecond).String())
+	}
+	if runErr != nil {
+		fail("FAIL", runErr)
+	}
+}
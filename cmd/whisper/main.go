@@ -1,10 +0,0 @@
-package main
-
-import (
-	"cavalier/pkg/cavalier"
-	stt "cavalier/pkg/whisper"
-)
-
-func main() {
-	cavalier.InitCavalier(stt.Init, stt.STT, stt.Name)
-}
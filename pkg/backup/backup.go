@@ -0,0 +1,408 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cavalier/pkg/vars"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// consistent backups of the user and jdocs databases (via SQLite's online backup API) plus the session-cert store,
+// packed into one .tar.gz. restore verifies an archive before swapping it in.
+
+const (
+	userDBName   = "user_database.db"
+	jdocsDBName  = "bot_database.db"
+	certsDirName = "session-certs"
+	manifestName = "manifest.json"
+)
+
+var userDB *sql.DB
+var jdocsDB *sql.DB
+
+// only one backup at a time, they each hold a read transaction on both databases
+var backupMu sync.Mutex
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Created string         `json:"created"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// Init sets the live database handles that backups are taken from
+func Init(userDBConn *sql.DB, jdocsDBConn *sql.DB) {
+	userDB = userDBConn
+	jdocsDB = jdocsDBConn
+}
+
+// copies the main database of src into a new database file at destPath
+func backupDB(src *sql.DB, destPath string) error {
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			destSQLite, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("destination is not a sqlite3 connection")
+			}
+			srcSQLite, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("source is not a sqlite3 connection")
+			}
+			bk, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			// -1 copies every page in one step, so the copy comes from a single snapshot
+			if _, err := bk.Step(-1); err != nil {
+				bk.Finish()
+				return err
+			}
+			return bk.Finish()
+		})
+	})
+}
+
+func addFileToTar(tw *tar.Writer, path string, name string, manifest *Manifest) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(tw, io.TeeReader(file, hash)); err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, ManifestFile{
+		Name:   name,
+		Size:   info.Size(),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// WriteArchive writes a .tar.gz backup of both databases and the session-cert store to w
+func WriteArchive(w io.Writer) error {
+	if userDB == nil || jdocsDB == nil {
+		return errors.New("WriteArchive: backup has not been initialized")
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	tmpDir, err := os.MkdirTemp("", "cavalier-backup-")
+	if err != nil {
+		return errors.New("WriteArchive: failed to create temp dir: " + err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+
+	userBackup := filepath.Join(tmpDir, userDBName)
+	if err := backupDB(userDB, userBackup); err != nil {
+		return errors.New("WriteArchive: failed to back up user database: " + err.Error())
+	}
+	jdocsBackup := filepath.Join(tmpDir, jdocsDBName)
+	if err := backupDB(jdocsDB, jdocsBackup); err != nil {
+		return errors.New("WriteArchive: failed to back up jdocs database: " + err.Error())
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	manifest := Manifest{Created: time.Now().UTC().Format(time.RFC3339)}
+
+	if err := addFileToTar(tw, userBackup, userDBName, &manifest); err != nil {
+		return errors.New("WriteArchive: failed to archive user database: " + err.Error())
+	}
+	if err := addFileToTar(tw, jdocsBackup, jdocsDBName, &manifest); err != nil {
+		return errors.New("WriteArchive: failed to archive jdocs database: " + err.Error())
+	}
+	certs, err := os.ReadDir(vars.SessionCertsStorage)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("WriteArchive: failed to read session cert storage: " + err.Error())
+	}
+	for _, cert := range certs {
+		if !cert.Type().IsRegular() {
+			continue
+		}
+		err := addFileToTar(tw, filepath.Join(vars.SessionCertsStorage, cert.Name()), certsDirName+"/"+cert.Name(), &manifest)
+		if err != nil {
+			return errors.New("WriteArchive: failed to archive session cert: " + err.Error())
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.New("WriteArchive: failed to marshal manifest: " + err.Error())
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0600,
+		Size:    int64(len(manifestBytes)),
+		ModTime: time.Now(),
+	})
+	if err == nil {
+		_, err = tw.Write(manifestBytes)
+	}
+	if err != nil {
+		return errors.New("WriteArchive: failed to write manifest: " + err.Error())
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.New("WriteArchive: failed to finish tar: " + err.Error())
+	}
+	if err := gw.Close(); err != nil {
+		return errors.New("WriteArchive: failed to finish gzip: " + err.Error())
+	}
+	return nil
+}
+
+// WriteArchiveFile writes a backup to path. The file only appears once the archive is complete.
+func WriteArchiveFile(path string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = WriteArchive(file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// DefaultArchiveName returns a timestamped file name for a new backup
+func DefaultArchiveName() string {
+	return "cavalier-backup-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+}
+
+// maps an archive entry to where it should be extracted, rejecting anything unexpected
+func entryPath(dir string, name string) (string, error) {
+	switch name {
+	case userDBName, jdocsDBName, manifestName:
+		return filepath.Join(dir, name), nil
+	}
+	if strings.HasPrefix(name, certsDirName+"/") {
+		certName := strings.TrimPrefix(name, certsDirName+"/")
+		if certName == "" || certName != filepath.Base(certName) || certName == ".." || certName == "." {
+			return "", fmt.Errorf("invalid session cert name in archive: %q", name)
+		}
+		return filepath.Join(dir, certsDirName, certName), nil
+	}
+	return "", fmt.Errorf("unexpected file in archive: %q", name)
+}
+
+func extractArchive(archivePath string, dir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	if err := os.MkdirAll(filepath.Join(dir, certsDirName), 0777); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry type in archive: %q", hdr.Name)
+		}
+		path, err := entryPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func verifyManifest(dir string) error {
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return errors.New("archive has no manifest: " + err.Error())
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return errors.New("failed to parse manifest: " + err.Error())
+	}
+	for _, mf := range manifest.Files {
+		path, err := entryPath(dir, mf.Name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s is listed in the manifest but missing: %v", mf.Name, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != mf.SHA256 {
+			return fmt.Errorf("%s does not match its checksum", mf.Name)
+		}
+	}
+	return nil
+}
+
+// runs PRAGMA integrity_check and makes sure the tables cavalier needs are there
+func checkDB(path string, tables []string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return errors.New("integrity check failed: " + result)
+	}
+	for _, table := range tables {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("missing table " + table)
+		}
+	}
+	return nil
+}
+
+// Verify extracts an archive into dir and checks its manifest and both databases
+func Verify(archivePath string, dir string) error {
+	if err := extractArchive(archivePath, dir); err != nil {
+		return errors.New("Verify: failed to extract archive: " + err.Error())
+	}
+	if err := verifyManifest(dir); err != nil {
+		return errors.New("Verify: " + err.Error())
+	}
+	if err := checkDB(filepath.Join(dir, userDBName), []string{"cavalier_users", "user_robots"}); err != nil {
+		return errors.New("Verify: user database: " + err.Error())
+	}
+	if err := checkDB(filepath.Join(dir, jdocsDBName), []string{"bot_jdocs"}); err != nil {
+		return errors.New("Verify: jdocs database: " + err.Error())
+	}
+	return nil
+}
+
+// moves path aside (with its WAL and SHM files) so it can be recovered if the restore was a mistake
+func moveAside(path string, suffix string) error {
+	for _, p := range []string{path, path + "-wal", path + "-shm"} {
+		if _, err := os.Stat(p); err == nil {
+			if err := os.Rename(p, p+suffix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore verifies an archive and swaps its contents in place of the current databases and session certs.
+// The server must not be running. The replaced files are kept with a .pre-restore-<time> suffix.
+func Restore(archivePath string) error {
+	// extract next to the databases so the final swap is a rename on the same filesystem
+	stageDir, err := os.MkdirTemp(filepath.Dir(vars.UserDBPath), ".cavalier-restore-")
+	if err != nil {
+		return errors.New("Restore: failed to create staging dir: " + err.Error())
+	}
+	defer os.RemoveAll(stageDir)
+
+	if err := Verify(archivePath, stageDir); err != nil {
+		return err
+	}
+	slog.Info("backup verified, swapping files in", "archive", archivePath)
+
+	suffix := ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+	swaps := []struct {
+		from string
+		to   string
+	}{
+		{filepath.Join(stageDir, userDBName), vars.UserDBPath},
+		{filepath.Join(stageDir, jdocsDBName), vars.JdocsDBPath},
+		{filepath.Join(stageDir, certsDirName), vars.SessionCertsStorage},
+	}
+	for _, swap := range swaps {
+		if err := moveAside(swap.to, suffix); err != nil {
+			return errors.New("Restore: failed to move aside " + swap.to + ": " + err.Error())
+		}
+		if err := os.Rename(swap.from, swap.to); err != nil {
+			return errors.New("Restore: failed to move in " + swap.to + ": " + err.Error())
+		}
+		slog.Info("restored from backup", "path", swap.to, "previous", swap.to+suffix)
+	}
+	return nil
+}
@@ -1,97 +1,244 @@
 package cavalier
 
 import (
+	"cavalier/pkg/backup"
+	"cavalier/pkg/certs"
+	"cavalier/pkg/health"
+	"cavalier/pkg/logging"
+	"cavalier/pkg/metrics"
 	processreqs "cavalier/pkg/preqs"
+	"cavalier/pkg/quota"
+	"cavalier/pkg/recording"
 	"cavalier/pkg/servers/accounts"
+	"cavalier/pkg/servers/admin"
 	chipperserver "cavalier/pkg/servers/chipper"
 	"cavalier/pkg/servers/jdocs"
 	"cavalier/pkg/servers/token"
 	"cavalier/pkg/sessions"
+	"cavalier/pkg/shutdown"
+	"cavalier/pkg/stt"
+	"cavalier/pkg/tracing"
 	"cavalier/pkg/users"
 	"cavalier/pkg/vars"
+	"context"
 	"crypto/tls"
-	"database/sql"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	chipperpb "github.com/digital-dream-labs/api/go/chipperpb"
 	"github.com/digital-dream-labs/api/go/jdocspb"
 	"github.com/digital-dream-labs/api/go/tokenpb"
-	grpcserver "github.com/digital-dream-labs/hugh/grpc/server"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 )
 
-func InitCavalier(InitFunc func() error, SttHandler interface{}, voiceProcessor string) {
-	vars.Init()
-	dbConn, err := sql.Open("sqlite3", "./user_database.db")
+// how long closing the databases and STT engine and flushing traces may take, after draining
+const closeTimeout = 10 * time.Second
+
+// InitCavalier starts every server, with the STT engine STT.provider names out of the ones
+// registered with stt
+func InitCavalier() {
+	if err := vars.Init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := logging.Init(vars.LogLevel, vars.LogFormat); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	slog.Info("loaded config", "source", vars.ConfigSource())
+	for _, warning := range vars.ConfigWarnings() {
+		slog.Warn(warning)
+	}
+	if err := tracing.Init(vars.TracingEndpoint, vars.TracingServiceName, vars.TracingSampleRatio); err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	dbConn, err := vars.OpenDB(vars.UserDBPath)
 	if err != nil {
-		fmt.Println("Failed to open database connection:", err)
+		slog.Error("failed to open database connection", "path", vars.UserDBPath, "error", err)
 		os.Exit(1)
 	}
 
-	defer dbConn.Close()
-
-	dbConnJdocs, err := sql.Open("sqlite3", "./bot_database.db")
+	dbConnJdocs, err := vars.OpenDB(vars.JdocsDBPath)
 	if err != nil {
-		fmt.Println("Failed to open jdocs database connection:", err)
+		slog.Error("failed to open jdocs database connection", "path", vars.JdocsDBPath, "error", err)
 		os.Exit(1)
 	}
 
-	defer dbConn.Close()
-	defer dbConnJdocs.Close()
-
 	users.Init(dbConn)
 	vars.InitJdocsDB(dbConnJdocs)
 	sessions.Init()
+	backup.Init(dbConn, dbConnJdocs)
+	recording.Init(dbConnJdocs)
+	health.Register("user_db", health.PingCheck(dbConn))
+	health.Register("jdocs_db", health.PingCheck(dbConnJdocs))
 
-	certPub, err := os.ReadFile(vars.CertPath)
-	if err != nil {
-		panic(err)
+	if vars.Config().Dev.Enable {
+		useDevCerts()
 	}
-	certPriv, err := os.ReadFile(vars.KeyPath)
+	if vars.CertPath == "" || vars.KeyPath == "" {
+		slog.Error("no TLS certificate configured, set server.cert and server.key (or " + vars.CertEnv + " and " + vars.KeyEnv + "), or turn on dev mode with " + vars.DevModeEnv + "=true to try cavalier out")
+		os.Exit(1)
+	}
+	serverCert, err := certs.Load(vars.CertPath, vars.KeyPath)
 	if err != nil {
-		panic(err)
+		slog.Error("failed to load tls certificate", "cert", vars.CertPath, "key", vars.KeyPath, "error", err)
+		os.Exit(1)
+	}
+	go serverCert.Watch()
+	health.Register("tls_cert", health.CertCheck(serverCert.Certificate))
+	accounts.ServerCert = serverCert.Certificate
+	if vars.Config().Server.EPConfig {
+		startLAN(serverCert)
 	}
-	cert, err := tls.X509KeyPair(certPub, certPriv)
+	// robots send a client certificate to the token server, it's read there but not verified
+	tlsConfig := &tls.Config{
+		GetCertificate: serverCert.GetCertificate,
+		ClientAuth:     tls.RequestClientCert,
+	}
+
+	quotaPolicies, err := quota.Load(vars.QuotaConfigPath)
 	if err != nil {
-		panic(err)
+		slog.Error("failed to load quota policies", "path", vars.QuotaConfigPath, "error", err)
+		os.Exit(1)
 	}
+	limiter := quota.New(quotaPolicies)
+	admin.Quotas = limiter
 
-	srv, err := grpcserver.New(
-		grpcserver.WithViper(),
-		grpcserver.WithReflectionService(),
-		grpcserver.WithCertificate(cert),
-		grpcserver.WithClientAuth(tls.RequestClientCert),
-	//	grpcserver.WithInsecureSkipVerify(),
+	grpcServer := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainStreamInterceptor(metrics.StreamInterceptor, limiter.StreamInterceptor),
+		grpc.ChainUnaryInterceptor(metrics.UnaryInterceptor, limiter.UnaryInterceptor),
 	)
+	reflection.Register(grpcServer)
+	for _, e := range stt.Engines() {
+		slog.Info("stt engine available", "engine", e.Name(), "capabilities", e.Capabilities())
+	}
+	engine, err := stt.Use(vars.Config().STT.Service)
 	if err != nil {
-		panic(err)
+		slog.Error("failed to pick an stt engine", "error", err)
+		os.Exit(1)
 	}
-	p, err := processreqs.New(InitFunc, SttHandler, voiceProcessor)
+	p, err := processreqs.New(engine)
 	if err != nil {
-		panic(err)
+		slog.Error("failed to start voice processor", "error", err)
+		os.Exit(1)
 	}
 	s, _ := chipperserver.New(
 		chipperserver.WithIntentProcessor(p),
 		chipperserver.WithKnowledgeGraphProcessor(p),
 		chipperserver.WithIntentGraphProcessor(p),
+		chipperserver.WithTextIntentProcessor(p),
 	)
 
 	tokenServer := token.NewTokenServer()
 	jdocsServer := jdocs.NewJdocsServer()
 	//jdocsserver.IniToJson()
 
-	chipperpb.RegisterChipperGrpcServer(srv.Transport(), s)
-	jdocspb.RegisterJdocsServer(srv.Transport(), jdocsServer)
-	tokenpb.RegisterTokenServer(srv.Transport(), tokenServer)
+	chipperpb.RegisterChipperGrpcServer(grpcServer, s)
+	jdocspb.RegisterJdocsServer(grpcServer, jdocsServer)
+	tokenpb.RegisterTokenServer(grpcServer, tokenServer)
+	health.RegisterGRPC(grpcServer)
 
-	listenerOne, err := net.Listen("tcp", ":8081")
+	listenerOne, err := net.Listen("tcp", vars.ChipperAddr)
 	if err != nil {
 		panic(err)
 	}
-	go srv.Transport().Serve(listenerOne)
+	slog.Info("chipper listening", "addr", vars.ChipperAddr)
+	go grpcServer.Serve(listenerOne)
 	http.HandleFunc("/v1/", accounts.AccountsAPI)
-	http.HandleFunc("/ok", accounts.AccountsAPI)
-	http.ListenAndServe(":8080", nil)
+	http.HandleFunc("/ok", health.Ready)
+	http.HandleFunc("/livez", health.Live)
+	http.HandleFunc("/readyz", health.Ready)
+	http.HandleFunc("/admin/", admin.AdminAPI)
+	if vars.MetricsAddr == "" {
+		http.Handle("/metrics", admin.Metrics(metrics.Handler()))
+	}
+	// no spans for probes and scrapes. the rest are named after the method only, paths carry
+	// ESNs and user IDs
+	handler := otelhttp.NewHandler(http.DefaultServeMux, "http",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/ok", "/livez", "/readyz", "/metrics":
+				return false
+			}
+			return true
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return "HTTP " + r.Method }),
+	)
+	var httpServers []*http.Server
+	if vars.AccountsAddr != "" {
+		httpServer := &http.Server{Addr: vars.AccountsAddr, Handler: handler}
+		httpServers = append(httpServers, httpServer)
+		slog.Info("accounts listening", "addr", vars.AccountsAddr)
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("http server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if vars.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer := &http.Server{Addr: vars.MetricsAddr, Handler: mux}
+		httpServers = append(httpServers, metricsServer)
+		slog.Info("metrics listening", "addr", vars.MetricsAddr)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if vars.AccountsTLSAddr != "" {
+		httpsServer := &http.Server{
+			Addr:      vars.AccountsTLSAddr,
+			Handler:   handler,
+			TLSConfig: &tls.Config{GetCertificate: serverCert.GetCertificate},
+		}
+		httpServers = append(httpServers, httpsServer)
+		slog.Info("accounts listening with tls", "addr", vars.AccountsTLSAddr)
+		go func() {
+			// the certificate comes from TLSConfig
+			if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				slog.Error("https server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	reloadOnSIGHUP()
+	waitForSignal()
+	drainCtx, cancel := context.WithTimeout(context.Background(), vars.ShutdownTimeout)
+	defer cancel()
+	drain(drainCtx, grpcServer, httpServers)
+
+	// the servers are stopped, so nothing new can touch the databases or STT engine.
+	// this gets its own deadline in case draining used all of the first
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancelClose()
+	if err := recording.Wait(closeCtx); err != nil {
+		slog.Warn("recordings still being saved at shutdown", "error", err)
+	}
+	if err := dbConnJdocs.Close(); err != nil {
+		slog.Error("failed to close jdocs database", "error", err)
+	}
+	if err := dbConn.Close(); err != nil {
+		slog.Error("failed to close user database", "error", err)
+	}
+	shutdown.Run(closeCtx)
+	if err := tracing.Shutdown(closeCtx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	slog.Info("shutdown complete")
 }
@@ -0,0 +1,31 @@
+package cavalier
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"cavalier/pkg/certs"
+	"cavalier/pkg/vars"
+)
+
+// dev mode serves a certificate from a local CA, kept next to the databases. the CA is printed
+// on every start so it's at hand when setting up a dev robot
+func useDevCerts() {
+	dev, err := certs.EnsureDev(filepath.Dir(vars.UserDBPath), vars.Config().Dev.Hosts)
+	if err != nil {
+		slog.Error("failed to set up dev certificates", "error", err)
+		os.Exit(1)
+	}
+	vars.CertPath = dev.CertPath
+	vars.KeyPath = dev.KeyPath
+	vars.CAPath = dev.CAPath
+	if dev.NewCA {
+		slog.Info("created dev CA", "path", dev.CAPath)
+	}
+	slog.Warn("dev mode, serving a certificate from the local dev CA. don't use this for real robots",
+		"ca", dev.CAPath, "cert", dev.CertPath, "hosts", dev.Hosts)
+	fmt.Println("Install this CA on your dev robot so it trusts cavalier (also in " + dev.CAPath + "):")
+	fmt.Print(string(dev.CAPEM))
+}
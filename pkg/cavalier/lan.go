@@ -0,0 +1,66 @@
+package cavalier
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+
+	"cavalier/pkg/certs"
+	"cavalier/pkg/mdns"
+	"cavalier/pkg/shutdown"
+	"cavalier/pkg/users"
+	"cavalier/pkg/vars"
+)
+
+// LAN mode (server.epconfig) stands in for an escape pod on a home network with no public DNS.
+// escape pod firmware looks for chipper, the token server and jdocs at escapepod.local, so that
+// name is answered over mDNS, the certificate has to be valid for it, and robots go on one
+// household account instead of everyone signing up
+func startLAN(serverCert *certs.Reloader) {
+	lan := vars.Config().LAN
+	host := lan.Hostname + ".local"
+	if err := serverCert.Certificate().Leaf.VerifyHostname(host); err != nil {
+		slog.Error("LAN mode needs a certificate for "+host+", the robot won't connect otherwise", "cert", vars.CertPath, "error", err)
+		os.Exit(1)
+	}
+
+	household, err := users.EnsureHousehold(lan.Household)
+	if err != nil {
+		slog.Error("failed to set up the household account", "email", lan.Household, "error", err)
+		os.Exit(1)
+	}
+
+	_, portStr, _ := net.SplitHostPort(vars.ChipperAddr)
+	port, _ := strconv.Atoi(portStr)
+	if port != 443 {
+		slog.Warn("escape pod firmware connects to port 443, chipper is listening somewhere else", "addr", vars.ChipperAddr)
+	}
+	// chipper, token and jdocs are all on the one gRPC listener
+	var services []mdns.Service
+	for _, name := range []string{"chipper", "token", "jdocs"} {
+		services = append(services, mdns.Service{
+			Instance: name,
+			Type:     "_escapepod._tcp",
+			Port:     uint16(port),
+			Text:     []string{"url=" + net.JoinHostPort(host, portStr)},
+		})
+	}
+	responder, err := mdns.Advertise(lan.Hostname, services)
+	if errors.Is(err, mdns.ErrConflict) {
+		// most likely a real escape pod, robots would get one or the other at random
+		slog.Error("another machine already answers for "+host+", not advertising over mdns", "error", err)
+		slog.Info("LAN mode", "host", host, "port", port, "household", household.Email)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to start mdns", "error", err)
+		os.Exit(1)
+	}
+	shutdown.Register("mdns", func(ctx context.Context) error {
+		return responder.Close()
+	})
+	slog.Info("LAN mode, advertising over mdns", "host", host, "port", port, "household", household.Email)
+}
@@ -0,0 +1,24 @@
+package cavalier
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cavalier/pkg/vars"
+)
+
+// reloads the config, blacklist and intents on SIGHUP, like POST /admin/reload
+func reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("reloading config", "signal", "SIGHUP")
+			if _, err := vars.Reload(); err != nil {
+				slog.Error("reload failed, keeping the running config", "error", err)
+			}
+		}
+	}()
+}
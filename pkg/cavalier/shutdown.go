@@ -0,0 +1,65 @@
+package cavalier
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"cavalier/pkg/health"
+	"cavalier/pkg/vars"
+
+	"google.golang.org/grpc"
+)
+
+// blocks until SIGINT or SIGTERM. a second one exits straight away
+func waitForSignal() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	slog.Info("shutting down", "signal", sig.String(), "timeout", vars.ShutdownTimeout)
+	go func() {
+		sig := <-sigs
+		slog.Warn("second signal, exiting without waiting", "signal", sig.String())
+		os.Exit(1)
+	}()
+}
+
+// stops taking new connections and gives the requests in flight until ctx is done to finish.
+// whatever is still running then is cut off
+func drain(ctx context.Context, grpcServer *grpc.Server, httpServers []*http.Server) {
+	health.Drain()
+	var wg sync.WaitGroup
+	wg.Add(1 + len(httpServers))
+	go func() {
+		defer wg.Done()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			slog.Info("grpc server stopped")
+		case <-ctx.Done():
+			slog.Warn("grpc streams still open at the shutdown deadline, closing them")
+			grpcServer.Stop()
+			<-stopped
+		}
+	}()
+	for _, httpServer := range httpServers {
+		go func(httpServer *http.Server) {
+			defer wg.Done()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				slog.Warn("http requests still running at the shutdown deadline, closing them", "addr", httpServer.Addr, "error", err)
+				httpServer.Close()
+				return
+			}
+			slog.Info("http server stopped", "addr", httpServer.Addr)
+		}(httpServer)
+	}
+	wg.Wait()
+}
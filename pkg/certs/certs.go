@@ -0,0 +1,98 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// the serving certificate. the files are checked for changes and re-read, so a renewal
+// (certbot, cert-manager) takes effect on new connections without a restart
+
+// how often the files are checked
+const watchInterval = 10 * time.Second
+
+type Reloader struct {
+	certPath string
+	keyPath  string
+	cert     atomic.Pointer[tls.Certificate]
+	// modification time and size of both files when they were last loaded
+	stamp string
+}
+
+// Load reads the certificate and key, and fails if they don't make a valid pair
+func Load(certPath, keyPath string) (*Reloader, error) {
+	r := &Reloader{certPath: certPath, keyPath: keyPath}
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return nil, errors.New("certs.Load: " + err.Error())
+	}
+	if err := r.load(); err != nil {
+		return nil, errors.New("certs.Load: " + err.Error())
+	}
+	r.stamp = stamp
+	return r, nil
+}
+
+func (r *Reloader) fileStamp() (string, error) {
+	var stamp string
+	for _, path := range []string{r.certPath, r.keyPath} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fi.ModTime().String() + "/" + strconv.FormatInt(fi.Size(), 10) + ";"
+	}
+	return stamp, nil
+}
+
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	r.cert.Store(&cert)
+	return nil
+}
+
+// Watch reloads the certificate whenever its files change. it doesn't return.
+// a pair that fails to load (say the cert is written before the key) keeps the old one
+// serving, and is tried again on the next change
+func (r *Reloader) Watch() {
+	for range time.Tick(watchInterval) {
+		stamp, err := r.fileStamp()
+		if err != nil {
+			slog.Error("failed to check tls certificate files", "error", err)
+			continue
+		}
+		if stamp == r.stamp {
+			continue
+		}
+		r.stamp = stamp
+		if err := r.load(); err != nil {
+			slog.Error("failed to reload tls certificate, keeping the old one", "cert", r.certPath, "error", err)
+			continue
+		}
+		slog.Info("tls certificate reloaded", "cert", r.certPath, "expires", r.Certificate().Leaf.NotAfter)
+	}
+}
+
+// Certificate is the one currently served
+func (r *Reloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate is for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
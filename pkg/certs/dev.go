@@ -0,0 +1,192 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dev mode: a local CA and a server certificate signed by it, so cavalier can be tried without
+// a real certificate. both are kept and reused. the server certificate is made again when it's
+// close to expiring or doesn't cover this machine's names and addresses any more
+
+const (
+	devCAFile      = "dev-ca.crt"
+	devCAKeyFile   = "dev-ca.key"
+	devCertFile    = "dev-server.crt"
+	devCertKeyFile = "dev-server.key"
+
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devCertValidity = 397 * 24 * time.Hour
+	devCertRenew    = 30 * 24 * time.Hour
+)
+
+type Dev struct {
+	CAPath   string
+	CertPath string
+	KeyPath  string
+	// the CA certificate, PEM encoded, for the robot to trust
+	CAPEM []byte
+	// names and addresses the server certificate is valid for
+	Hosts []string
+	// whether the CA was made just now
+	NewCA bool
+}
+
+// EnsureDev makes (or reuses) the dev CA and server certificate in dir. the server certificate
+// covers localhost, this machine's hostname and addresses, and extraHosts
+func EnsureDev(dir string, extraHosts []string) (Dev, error) {
+	dev := Dev{
+		CAPath:   filepath.Join(dir, devCAFile),
+		CertPath: filepath.Join(dir, devCertFile),
+		KeyPath:  filepath.Join(dir, devCertKeyFile),
+		Hosts:    append(localHosts(), extraHosts...),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return dev, errors.New("certs.EnsureDev: " + err.Error())
+	}
+	caKeyPath := filepath.Join(dir, devCAKeyFile)
+
+	caPair, err := tls.LoadX509KeyPair(dev.CAPath, caKeyPath)
+	if os.IsNotExist(err) {
+		caPair, err = newDevCA(dev.CAPath, caKeyPath)
+		dev.NewCA = true
+	}
+	if err != nil {
+		return dev, errors.New("certs.EnsureDev: CA: " + err.Error())
+	}
+	ca, err := x509.ParseCertificate(caPair.Certificate[0])
+	if err != nil {
+		return dev, errors.New("certs.EnsureDev: CA: " + err.Error())
+	}
+	dev.CAPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	if !devCertUsable(dev.CertPath, dev.KeyPath, ca, dev.Hosts) {
+		if err := newDevCert(dev.CertPath, dev.KeyPath, ca, caPair.PrivateKey.(crypto.Signer), dev.Hosts); err != nil {
+			return dev, errors.New("certs.EnsureDev: server certificate: " + err.Error())
+		}
+	}
+	return dev, nil
+}
+
+// localhost, the hostname (plain and .local for mDNS) and every address of the machine
+func localHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		hosts = append(hosts, name, name+".local")
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		hosts = append(hosts, ipnet.IP.String())
+	}
+	return hosts
+}
+
+// the existing server certificate is signed by ca, not expiring soon and covers every host
+func devCertUsable(certPath, keyPath string, ca *x509.Certificate, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || leaf.CheckSignatureFrom(ca) != nil || time.Until(leaf.NotAfter) < devCertRenew {
+		return false
+	}
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+}
+
+func newDevCA(certPath, keyPath string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cavalier dev CA", Organization: []string{"cavalier"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := writePair(certPath, keyPath, der, key); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+func newDevCert(certPath, keyPath string, ca *x509.Certificate, caKey crypto.Signer, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"cavalier"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(devCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return err
+	}
+	return writePair(certPath, keyPath, der, key)
+}
+
+// the key is written first and only readable by us
+func writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
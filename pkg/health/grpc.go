@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// how often the gRPC health status is refreshed from the checks
+const watchInterval = 10 * time.Second
+
+var grpcServer = grpchealth.NewServer()
+
+// RegisterGRPC serves grpc.health.v1 on s, after the other services are registered. the overall
+// status ("") and each service's are SERVING while every check passes, and updated in the background.
+func RegisterGRPC(s *grpc.Server) {
+	services := []string{""}
+	for name := range s.GetServiceInfo() {
+		services = append(services, name)
+	}
+	healthpb.RegisterHealthServer(s, grpcServer)
+	update := func(last healthpb.HealthCheckResponse_ServingStatus) healthpb.HealthCheckResponse_ServingStatus {
+		report := Run(context.Background())
+		status := healthpb.HealthCheckResponse_SERVING
+		if !report.OK() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if status != last {
+			if status == healthpb.HealthCheckResponse_SERVING {
+				slog.Info("server is ready")
+			} else {
+				slog.Warn("server is not ready", "checks", report.Checks)
+			}
+		}
+		for _, service := range services {
+			grpcServer.SetServingStatus(service, status)
+		}
+		return status
+	}
+	last := update(healthpb.HealthCheckResponse_SERVICE_UNKNOWN)
+	if draining.Load() {
+		grpcServer.Shutdown()
+	}
+	go func() {
+		for range time.Tick(watchInterval) {
+			last = update(last)
+		}
+	}()
+}
+
+// Drain fails readiness from now on and sets every gRPC service to NOT_SERVING, so load balancers
+// stop sending requests while the ones in flight finish
+func Drain() {
+	draining.Store(true)
+	grpcServer.Shutdown()
+}
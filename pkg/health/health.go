@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// liveness and readiness. the parts of the server that can break at runtime (databases, the STT
+// engine, the VAD model, the certificate) register a check, and readiness runs them all.
+// the same status is served over grpc.health.v1, see grpc.go
+
+// Check returns nil if the thing it checks is usable
+type Check func(ctx context.Context) error
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// each check gets this long before it counts as failed
+const checkTimeout = 2 * time.Second
+
+var (
+	mu     sync.RWMutex
+	checks = map[string]Check{}
+
+	draining atomic.Bool
+)
+
+// Register adds a readiness check. registering a name again replaces its check.
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs every check at once and reports which failed
+func Run(ctx context.Context) Report {
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	toRun := make([]Check, len(names))
+	for i, name := range names {
+		toRun[i] = checks[name]
+	}
+	mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range toRun {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = runCheck(ctx, toRun[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	if draining.Load() {
+		report.Status = StatusFail
+		report.Checks["shutdown"] = Result{Status: StatusFail, Error: "server is shutting down"}
+	}
+	for i, name := range names {
+		if errs[i] != nil {
+			report.Status = StatusFail
+			report.Checks[name] = Result{Status: StatusFail, Error: errs[i].Error()}
+		} else {
+			report.Checks[name] = Result{Status: StatusOK}
+		}
+	}
+	return report
+}
+
+// a check that hangs (a locked database) fails at the timeout instead of holding up the probe
+func runCheck(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("timed out")
+	}
+}
+
+// Live answers liveness probes. the process is up and serving HTTP, nothing else is checked,
+// so a broken dependency gets the server taken out of rotation rather than restarted
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// Ready answers readiness probes: 200 if every check passes, 503 with the failures otherwise
+func Ready(w http.ResponseWriter, r *http.Request) {
+	report := Run(r.Context())
+	code := http.StatusOK
+	if !report.OK() {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// PingCheck checks a database can still be reached
+func PingCheck(pinger interface {
+	PingContext(ctx context.Context) error
+}) Check {
+	return func(ctx context.Context) error {
+		return pinger.PingContext(ctx)
+	}
+}
+
+// CertCheck fails once the serving certificate is expired or not yet valid
+func CertCheck(cert func() *tls.Certificate) Check {
+	return func(ctx context.Context) error {
+		c := cert()
+		if c == nil || len(c.Certificate) == 0 {
+			return errors.New("no certificate loaded")
+		}
+		leaf := c.Leaf
+		if leaf == nil {
+			var err error
+			leaf, err = x509.ParseCertificate(c.Certificate[0])
+			if err != nil {
+				return errors.New("CertCheck: " + err.Error())
+			}
+		}
+		now := time.Now()
+		if now.After(leaf.NotAfter) {
+			return errors.New("certificate expired at " + leaf.NotAfter.Format(time.RFC3339))
+		}
+		if now.Before(leaf.NotBefore) {
+			return errors.New("certificate not valid until " + leaf.NotBefore.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
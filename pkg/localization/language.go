@@ -0,0 +1,60 @@
+package localization
+
+import (
+	"strings"
+
+	"cavalier/pkg/vars"
+)
+
+// each request is handled in its robot's language, if it's one of the loaded ones (STT.language
+// and STT.languages). robots say which in LangString, but that only has a few languages and
+// defaults to ENGLISH_US, so the locale in the robot's vic.RobotSettings is asked too
+
+// what robots send in LangString, as locales
+var langStrings = map[string]string{
+	"ENGLISH_US": "en-US",
+	"ENGLISH_UK": "en-GB",
+	"ENGLISH_AU": "en-AU",
+	"GERMAN":     "de-DE",
+	"FRENCH":     "fr-FR",
+}
+
+// RequestLanguage picks the language for a request: a LangString other than the default, then the
+// robot's locale, then the LangString anyway. the first one that's loaded wins, or one loaded for
+// the same language in another region (en-GB gets en-US). if none are, the default language
+func RequestLanguage(langString string, settings vars.RobotSettings) string {
+	loaded := vars.Languages()
+	var candidates []string
+	fromRequest := langStrings[langString]
+	if fromRequest != "" && langString != "ENGLISH_US" {
+		candidates = append(candidates, fromRequest)
+	}
+	if settings.Locale != "" {
+		candidates = append(candidates, strings.ReplaceAll(settings.Locale, "_", "-"))
+	}
+	if fromRequest != "" {
+		candidates = append(candidates, fromRequest)
+	}
+	for _, candidate := range candidates {
+		if language := matchLanguage(candidate, loaded); language != "" {
+			return language
+		}
+	}
+	return loaded[0]
+}
+
+// the loaded language for locale, exactly or by its language part
+func matchLanguage(locale string, loaded []string) string {
+	for _, language := range loaded {
+		if strings.EqualFold(language, locale) {
+			return language
+		}
+	}
+	prefix, _, _ := strings.Cut(locale, "-")
+	for _, language := range loaded {
+		if other, _, _ := strings.Cut(language, "-"); strings.EqualFold(other, prefix) {
+			return language
+		}
+	}
+	return ""
+}
@@ -1,7 +1,5 @@
 package localization
 
-import "cavalier/pkg/vars"
-
 var ValidVoskModels []string = []string{"en-US", "it-IT", "es-ES", "fr-FR", "de-DE", "pt-BR", "pl-PL", "zh-CN", "tr-TR", "ru-RU", "nt-NL", "uk-UA", "vi-VN", "ko-KR"}
 
 const STR_WEATHER_IN = "str_weather_in"
@@ -226,41 +224,28 @@ var texts = map[string][]string{
 	STR_SECOND:                         {"second", "secondi", "second", "seconde", "second", "second", "second", "second", "second", "second", "second", "second", "초"},
 }
 
-func GetText(key string) string {
-	var data = texts[key]
-	if data != nil {
-		if vars.APIConfig.STT.Language == "it-IT" {
-			return data[1]
-		} else if vars.APIConfig.STT.Language == "es-ES" {
-			return data[2]
-		} else if vars.APIConfig.STT.Language == "fr-FR" {
-			return data[3]
-		} else if vars.APIConfig.STT.Language == "de-DE" {
-			return data[4]
-		} else if vars.APIConfig.STT.Language == "pl-PL" {
-			return data[5]
-		} else if vars.APIConfig.STT.Language == "zh-CN" {
-			return data[6]
-		} else if vars.APIConfig.STT.Language == "tr-TR" {
-			return data[7]
-		} else if vars.APIConfig.STT.Language == "ru-RU" {
-			return data[8]
-		} else if vars.APIConfig.STT.Language == "nt-NL" {
-			return data[9]
-		} else if vars.APIConfig.STT.Language == "uk-UA" {
-			return data[10]
-		} else if vars.APIConfig.STT.Language == "vi-VN" {
-			return data[11]
-		} else if vars.APIConfig.STT.Language == "ko-KR" {
-			return data[12]
-		}
-	}
-	return data[0]
+// the column of texts each language is in. anything else is English
+var textColumns = map[string]int{
+	"it-IT": 1,
+	"es-ES": 2,
+	"fr-FR": 3,
+	"de-DE": 4,
+	"pl-PL": 5,
+	"zh-CN": 6,
+	"tr-TR": 7,
+	"ru-RU": 8,
+	"nt-NL": 9,
+	"uk-UA": 10,
+	"vi-VN": 11,
+	"ko-KR": 12,
 }
 
-func ReloadVosk() {
-	if vars.APIConfig.STT.Service == "vosk" || vars.APIConfig.STT.Service == "whisper.cpp" {
-		vars.IntentList, _ = vars.LoadIntents()
-		vars.SttInitFunc()
+// GetText is the text for key in language, like "de-DE"
+func GetText(key string, language string) string {
+	data := texts[key]
+	if data == nil {
+		// not "", every text would contain that
+		return key
 	}
+	return data[textColumns[language]]
 }
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// structured, levelled logging for the server. everything goes through the slog default logger,
+// so packages just call slog.Info etc. or use Request for a logger tied to one chipper request.
+
+// Init replaces the default logger. level is debug, info, warn or error, format is json or text.
+func Init(level string, format string) error {
+	return InitWriter(os.Stdout, level, format)
+}
+
+// InitWriter is Init, writing to w
+func InitWriter(w io.Writer, level string, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return errors.New("logging.Init: invalid level " + level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return errors.New("logging.Init: invalid format " + format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// NewRequestID returns a short random ID for tying together the log lines of one request
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Request returns a logger that adds the request ID and robot ESN to every line
+func Request(requestID string, esn string) *slog.Logger {
+	return slog.Default().With("request_id", requestID, "esn", esn)
+}
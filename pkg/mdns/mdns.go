@@ -0,0 +1,597 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// a small mDNS responder (RFC 6762) for LAN mode. it answers for one hostname, <host>.local, with
+// this machine's IPv4 addresses, and advertises services on it with DNS-SD (RFC 6763). it only
+// answers, it never asks, so it can run next to avahi or another responder on the same machine.
+// the names are probed for before they're claimed, and given up if another machine has them
+
+const (
+	// how long others may cache our records
+	ttl = 120
+	// sent to twice at startup so other machines pick up the name straight away
+	announceInterval = time.Second
+	// RFC 6762 8.1, three probes this far apart
+	probes = 3
+	// RFC 6762 10.2, on records only we answer for
+	cacheFlush = 1 << 15
+	// RFC 6762 5.4, the asker wants the answer sent straight to it
+	unicastResponse = 1 << 15
+)
+
+// a var so tests don't wait
+var probeInterval = 250 * time.Millisecond
+
+// ErrConflict is returned by Advertise when another machine already answers for one of the names
+var ErrConflict = errors.New("name is already in use on the network")
+
+var group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+type Service struct {
+	// the instance name, like chipper
+	Instance string
+	// the DNS-SD type, like _escapepod._tcp
+	Type string
+	Port uint16
+	Text []string
+}
+
+type Responder struct {
+	host     dnsmessage.Name
+	services []Service
+	conn     *net.UDPConn
+	closed   chan struct{}
+	once     sync.Once
+	// so an announcement can't follow the goodbye
+	sendMu sync.Mutex
+	// the addresses answered with, addresses outside tests
+	addrs func() [][4]byte
+
+	// set until probing is done, names that aren't ours yet aren't answered for
+	probing atomic.Bool
+	// set once another machine has shown it owns one of the names, after which nothing is answered
+	lost atomic.Bool
+	// the first name found to be taken while probing
+	conflict chan string
+}
+
+// Advertise claims host.local and the services' names, then answers for them until Close. it
+// returns ErrConflict if another machine answers for any of them
+func Advertise(host string, services []Service) (*Responder, error) {
+	r, err := newResponder(host, services)
+	if err != nil {
+		return nil, errors.New("mdns.Advertise: " + err.Error())
+	}
+	r.conn, err = net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, errors.New("mdns.Advertise: " + err.Error())
+	}
+	go r.serve()
+	if err := r.probe(); err != nil {
+		r.conn.Close()
+		return nil, err
+	}
+	go r.announce()
+	return r, nil
+}
+
+func newResponder(host string, services []Service) (*Responder, error) {
+	host, err := fqdn(host + ".local")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		if _, err := dnsmessage.NewName(s.instanceName()); err != nil {
+			return nil, errors.New("service " + s.Instance + ": " + err.Error())
+		}
+	}
+	r := &Responder{
+		host:     dnsmessage.MustNewName(host),
+		services: services,
+		closed:   make(chan struct{}),
+		addrs:    addresses,
+		conflict: make(chan string, 1),
+	}
+	r.probing.Store(true)
+	return r, nil
+}
+
+func fqdn(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	_, err := dnsmessage.NewName(name)
+	return name, err
+}
+
+func (s Service) typeName() string {
+	return strings.ToLower(s.Type) + ".local."
+}
+
+func (s Service) instanceName() string {
+	return strings.ToLower(s.Instance) + "." + s.typeName()
+}
+
+// Close says goodbye (records with a TTL of 0, so caches drop them) and stops answering
+func (r *Responder) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.sendMu.Lock()
+		defer r.sendMu.Unlock()
+		close(r.closed)
+		if !r.lost.Load() {
+			if msg, buildErr := r.build(0, r.allQuestions(), false); buildErr == nil {
+				r.conn.WriteToUDP(msg, group)
+			}
+		}
+		err = r.conn.Close()
+	})
+	return err
+}
+
+// RFC 6762 8.1: after a random wait of up to 250ms, three queries for our names carrying the
+// records we want in the authority section. any answer for the names, or a probe for them that
+// wins the tie-break, means they're taken
+func (r *Responder) probe() error {
+	time.Sleep(time.Duration(rand.Int63n(int64(probeInterval))))
+	for i := 0; i < probes; i++ {
+		// the first probe asks for unicast answers, so a conflict is heard about sooner
+		msg, err := r.buildProbe(i == 0)
+		if err != nil {
+			return errors.New("mdns.Advertise: " + err.Error())
+		}
+		if _, err := r.conn.WriteToUDP(msg, group); err != nil {
+			return errors.New("mdns.Advertise: " + err.Error())
+		}
+		select {
+		case name := <-r.conflict:
+			return fmt.Errorf("mdns.Advertise: %s: %w", name, ErrConflict)
+		case <-time.After(probeInterval):
+		}
+	}
+	r.probing.Store(false)
+	select {
+	case name := <-r.conflict:
+		return fmt.Errorf("mdns.Advertise: %s: %w", name, ErrConflict)
+	default:
+	}
+	return nil
+}
+
+func (r *Responder) announce() {
+	for i := 0; i < 2; i++ {
+		if r.lost.Load() {
+			return
+		}
+		if err := r.sendAnnouncement(); err != nil {
+			slog.Warn("failed to send mdns announcement", "error", err)
+		}
+		select {
+		case <-r.closed:
+			return
+		case <-time.After(announceInterval):
+		}
+	}
+}
+
+func (r *Responder) sendAnnouncement() error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	select {
+	case <-r.closed:
+		return nil
+	default:
+	}
+	msg, err := r.build(0, r.allQuestions(), false)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.WriteToUDP(msg, group)
+	return err
+}
+
+func (r *Responder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-r.closed:
+				return
+			default:
+			}
+			slog.Warn("mdns read failed", "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if msg, to := r.handle(buf[:n], from); msg != nil {
+			r.conn.WriteToUDP(msg, to)
+		}
+	}
+}
+
+// the reply to packet and where it goes, or nil when there's nothing to say
+func (r *Responder) handle(packet []byte, from *net.UDPAddr) ([]byte, *net.UDPAddr) {
+	if r.lost.Load() {
+		return nil, nil
+	}
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil {
+		return nil, nil
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, nil
+	}
+	if header.Response {
+		answers, err := p.AllAnswers()
+		if err != nil {
+			return nil, nil
+		}
+		if name := r.answeredElsewhere(answers); name != "" {
+			r.yield(name)
+		}
+		return nil, nil
+	}
+	if r.probing.Load() {
+		// a probe for the same names as ours, see outprobed
+		if err := p.SkipAllAnswers(); err != nil {
+			return nil, nil
+		}
+		authorities, err := p.AllAuthorities()
+		if err != nil {
+			return nil, nil
+		}
+		if name := r.outprobed(authorities); name != "" {
+			r.yield(name)
+		}
+		return nil, nil
+	}
+
+	// a port other than 5353 is a plain DNS client (RFC 6762 6.7), it only hears a direct answer
+	// and wants its ID and questions back
+	legacy := from.Port != group.Port
+	unicast := legacy
+	var ours []dnsmessage.Question
+	for _, q := range questions {
+		if r.answers(q) {
+			ours = append(ours, q)
+			if q.Class&unicastResponse != 0 {
+				unicast = true
+			}
+		}
+	}
+	if len(ours) == 0 {
+		return nil, nil
+	}
+	var id uint16
+	if legacy {
+		id = header.ID
+	}
+	msg, err := r.build(id, ours, legacy)
+	if err != nil {
+		slog.Error("failed to build mdns answer", "error", err)
+		return nil, nil
+	}
+	if unicast {
+		return msg, from
+	}
+	return msg, group
+}
+
+// another machine has name. while probing that fails Advertise, after it (RFC 6762 9) the names
+// are given up: they're fixed, there's no other name robots would look for
+func (r *Responder) yield(name string) {
+	if r.probing.Load() {
+		select {
+		case r.conflict <- name:
+		default:
+		}
+		return
+	}
+	if !r.lost.Swap(true) {
+		slog.Error("another machine on the network answers for "+name+", no longer advertising it", "host", r.host.String())
+	}
+}
+
+// our unique names (the host and the service instances) that a response has different records
+// for. our own responses come back to us with the same records, and don't count
+func (r *Responder) answeredElsewhere(answers []dnsmessage.Resource) string {
+	for _, a := range answers {
+		name := strings.ToLower(a.Header.Name.String())
+		ours := r.recordKeys(name)
+		if ours == nil {
+			continue
+		}
+		if key, ok := recordKey(a); ok && !slices.Contains(ours, key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// RFC 6762 8.2: when two machines probe for a name at once, the one with the lexicographically
+// later records wins. a probe with the same records is our own coming back
+func (r *Responder) outprobed(authorities []dnsmessage.Resource) string {
+	theirs := map[string][]string{}
+	for _, a := range authorities {
+		name := strings.ToLower(a.Header.Name.String())
+		if key, ok := recordKey(a); ok && r.recordKeys(name) != nil {
+			theirs[name] = append(theirs[name], key)
+		}
+	}
+	for name, keys := range theirs {
+		ours := r.recordKeys(name)
+		slices.Sort(ours)
+		slices.Sort(keys)
+		if slices.Compare(keys, ours) > 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// our records for name in the form recordKey gives, nil if name isn't one of our unique ones
+func (r *Responder) recordKeys(name string) []string {
+	if name == r.host.String() {
+		keys := []string{}
+		for _, ip := range r.addrs() {
+			keys = append(keys, aKey(ip))
+		}
+		return keys
+	}
+	for _, s := range r.services {
+		if name == s.instanceName() {
+			return []string{srvKey(0, 0, s.Port, r.host.String()), txtKey(serviceText(s))}
+		}
+	}
+	return nil
+}
+
+// a record's class, type and data, in the order RFC 6762 8.2 compares them. only the kinds of
+// record we publish under unique names are understood
+func recordKey(res dnsmessage.Resource) (string, bool) {
+	switch body := res.Body.(type) {
+	case *dnsmessage.AResource:
+		return aKey(body.A), true
+	case *dnsmessage.SRVResource:
+		return srvKey(body.Priority, body.Weight, body.Port, strings.ToLower(body.Target.String())), true
+	case *dnsmessage.TXTResource:
+		return txtKey(body.TXT), true
+	}
+	return "", false
+}
+
+func keyPrefix(t dnsmessage.Type) []byte {
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, uint16(dnsmessage.ClassINET)), uint16(t))
+}
+
+func aKey(ip [4]byte) string {
+	return string(append(keyPrefix(dnsmessage.TypeA), ip[:]...))
+}
+
+func srvKey(priority, weight, port uint16, target string) string {
+	key := keyPrefix(dnsmessage.TypeSRV)
+	for _, v := range []uint16{priority, weight, port} {
+		key = binary.BigEndian.AppendUint16(key, v)
+	}
+	return string(append(key, target...))
+}
+
+func txtKey(text []string) string {
+	key := keyPrefix(dnsmessage.TypeTXT)
+	for _, t := range text {
+		key = append(append(key, byte(len(t))), t...)
+	}
+	return string(key)
+}
+
+// a TXT record needs at least one string
+func serviceText(s Service) []string {
+	if len(s.Text) == 0 {
+		return []string{""}
+	}
+	return s.Text
+}
+
+// whether we have records for q
+func (r *Responder) answers(q dnsmessage.Question) bool {
+	name := strings.ToLower(q.Name.String())
+	switch name {
+	case r.host.String():
+		return q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL
+	case "_services._dns-sd._udp.local.":
+		return q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL
+	}
+	for _, s := range r.services {
+		switch name {
+		case s.typeName():
+			return q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL
+		case s.instanceName():
+			return q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL
+		}
+	}
+	return false
+}
+
+// every record we have, for announcing and saying goodbye
+func (r *Responder) allQuestions() []dnsmessage.Question {
+	questions := []dnsmessage.Question{{Name: r.host, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}
+	seen := map[string]bool{}
+	for _, s := range r.services {
+		if !seen[s.typeName()] {
+			seen[s.typeName()] = true
+			questions = append(questions, dnsmessage.Question{Name: dnsmessage.MustNewName(s.typeName()), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET})
+		}
+		questions = append(questions, dnsmessage.Question{Name: dnsmessage.MustNewName(s.instanceName()), Type: dnsmessage.TypeALL, Class: dnsmessage.ClassINET})
+	}
+	return questions
+}
+
+// the names we want to own, asked about with type ANY
+func (r *Responder) uniqueQuestions(unicast bool) []dnsmessage.Question {
+	class := dnsmessage.ClassINET
+	if unicast {
+		class |= unicastResponse
+	}
+	questions := []dnsmessage.Question{{Name: r.host, Type: dnsmessage.TypeALL, Class: class}}
+	for _, s := range r.services {
+		questions = append(questions, dnsmessage.Question{Name: dnsmessage.MustNewName(s.instanceName()), Type: dnsmessage.TypeALL, Class: class})
+	}
+	return questions
+}
+
+// a probe: the questions for our unique names, and the records we'd answer them with as
+// authorities
+func (r *Responder) buildProbe(unicast bool) ([]byte, error) {
+	questions := r.uniqueQuestions(unicast)
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.StartAuthorities(); err != nil {
+		return nil, err
+	}
+	// no cache flush bit on proposed records
+	header := func(name dnsmessage.Name, unique bool) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+	if err := r.records(&b, questions, header); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// the answer to questions. an id of 0 with no legacy client is a normal mDNS response, which
+// carries no questions. a goodbye is built with allQuestions after closed, and gets a TTL of 0
+func (r *Responder) build(id uint16, questions []dnsmessage.Question, legacy bool) ([]byte, error) {
+	recordTTL := uint32(ttl)
+	select {
+	case <-r.closed:
+		recordTTL = 0
+	default:
+	}
+	// legacy clients don't know the cache flush bit and would see an unknown class
+	flush := dnsmessage.Class(cacheFlush)
+	if legacy {
+		flush = 0
+		recordTTL = min(recordTTL, 10)
+	}
+	header := func(name dnsmessage.Name, unique bool) dnsmessage.ResourceHeader {
+		class := dnsmessage.ClassINET
+		if unique {
+			class |= flush
+		}
+		return dnsmessage.ResourceHeader{Name: name, Class: class, TTL: recordTTL}
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	b.EnableCompression()
+	if legacy {
+		if err := b.StartQuestions(); err != nil {
+			return nil, err
+		}
+		for _, q := range questions {
+			q.Class &^= unicastResponse
+			if err := b.Question(q); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if err := r.records(&b, questions, header); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// writes our records for questions to the section b is in. header gives each record's header,
+// unique for the ones only we answer for
+func (r *Responder) records(b *dnsmessage.Builder, questions []dnsmessage.Question, header func(name dnsmessage.Name, unique bool) dnsmessage.ResourceHeader) error {
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		if name == r.host.String() {
+			for _, ip := range r.addrs() {
+				if err := b.AResource(header(r.host, true), dnsmessage.AResource{A: ip}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		types := map[string]bool{}
+		for _, s := range r.services {
+			instance := dnsmessage.MustNewName(s.instanceName())
+			switch name {
+			case "_services._dns-sd._udp.local.":
+				if types[s.typeName()] {
+					continue
+				}
+				types[s.typeName()] = true
+				err := b.PTRResource(header(q.Name, false), dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(s.typeName())})
+				if err != nil {
+					return err
+				}
+			case s.typeName():
+				if err := b.PTRResource(header(q.Name, false), dnsmessage.PTRResource{PTR: instance}); err != nil {
+					return err
+				}
+			case s.instanceName():
+				if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+					if err := b.SRVResource(header(instance, true), dnsmessage.SRVResource{Target: r.host, Port: s.Port}); err != nil {
+						return err
+					}
+				}
+				if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+					if err := b.TXTResource(header(instance, true), dnsmessage.TXTResource{TXT: serviceText(s)}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// the IPv4 addresses robots can reach us on
+func addresses() [][4]byte {
+	var ips [][4]byte
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip4 := ipnet.IP.To4(); ip4 != nil && !ip4.IsLinkLocalUnicast() {
+				ips = append(ips, [4]byte(ip4))
+			}
+		}
+	}
+	return ips
+}
@@ -0,0 +1,309 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	ours    = [4]byte{192, 168, 1, 10}
+	peer    = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 5353}
+	legacy  = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 51234}
+	host    = dnsmessage.MustNewName("escapepod.local.")
+	typ     = dnsmessage.MustNewName("_escapepod._tcp.local.")
+	chipper = dnsmessage.MustNewName("chipper._escapepod._tcp.local.")
+	meta    = dnsmessage.MustNewName("_services._dns-sd._udp.local.")
+)
+
+func testResponder(t *testing.T) *Responder {
+	t.Helper()
+	var services []Service
+	for _, name := range []string{"chipper", "token", "jdocs"} {
+		services = append(services, Service{Instance: name, Type: "_escapepod._tcp", Port: 443, Text: []string{"url=escapepod.local:443"}})
+	}
+	r, err := newResponder("escapepod", services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.addrs = func() [][4]byte { return [][4]byte{ours} }
+	r.probing.Store(false)
+	return r
+}
+
+func question(name dnsmessage.Name, typ dnsmessage.Type, unicast bool) dnsmessage.Question {
+	q := dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET}
+	if unicast {
+		q.Class |= unicastResponse
+	}
+	return q
+}
+
+func aRecord(ip [4]byte) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: host, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: ip},
+	}
+}
+
+func pack(t *testing.T, m dnsmessage.Message) []byte {
+	t.Helper()
+	packet, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func unpack(t *testing.T, packet []byte) dnsmessage.Message {
+	t.Helper()
+	var m dnsmessage.Message
+	if err := m.Unpack(packet); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     dnsmessage.Message
+		from    *net.UDPAddr
+		probing bool
+		// nil when no reply is expected
+		to    *net.UDPAddr
+		check func(t *testing.T, m dnsmessage.Message)
+	}{
+		{
+			name: "multicast A",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(host, dnsmessage.TypeA, false)}},
+			from: peer,
+			to:   group,
+			check: func(t *testing.T, m dnsmessage.Message) {
+				if m.ID != 0 || len(m.Questions) != 0 {
+					t.Errorf("ID %d and %d questions, want neither", m.ID, len(m.Questions))
+				}
+				if len(m.Answers) != 1 {
+					t.Fatalf("%d answers, want 1", len(m.Answers))
+				}
+				a := m.Answers[0]
+				if a.Body.(*dnsmessage.AResource).A != ours || a.Header.Class != dnsmessage.ClassINET|cacheFlush || a.Header.TTL != ttl {
+					t.Errorf("got %v", a)
+				}
+			},
+		},
+		{
+			name: "QU bit",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(host, dnsmessage.TypeA, true)}},
+			from: peer,
+			to:   peer,
+		},
+		{
+			name: "legacy unicast",
+			msg:  dnsmessage.Message{Header: dnsmessage.Header{ID: 0x1234}, Questions: []dnsmessage.Question{question(host, dnsmessage.TypeA, false)}},
+			from: legacy,
+			to:   legacy,
+			check: func(t *testing.T, m dnsmessage.Message) {
+				if m.ID != 0x1234 {
+					t.Errorf("ID %#x, want 0x1234", m.ID)
+				}
+				if len(m.Questions) != 1 || m.Questions[0].Name != host {
+					t.Errorf("questions %v, want the one asked", m.Questions)
+				}
+				for _, a := range m.Answers {
+					if a.Header.Class != dnsmessage.ClassINET || a.Header.TTL > 10 {
+						t.Errorf("got %v, want no cache flush and a TTL of at most 10", a.Header)
+					}
+				}
+			},
+		},
+		{
+			name: "services meta query",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(meta, dnsmessage.TypePTR, false)}},
+			from: peer,
+			to:   group,
+			check: func(t *testing.T, m dnsmessage.Message) {
+				// three instances, one type
+				if len(m.Answers) != 1 || m.Answers[0].Body.(*dnsmessage.PTRResource).PTR != typ {
+					t.Errorf("got %v, want one PTR to %s", m.Answers, typ)
+				}
+				if m.Answers[0].Header.Class != dnsmessage.ClassINET {
+					t.Error("shared PTR records must not have the cache flush bit")
+				}
+			},
+		},
+		{
+			name: "service type",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(typ, dnsmessage.TypePTR, false)}},
+			from: peer,
+			to:   group,
+			check: func(t *testing.T, m dnsmessage.Message) {
+				if len(m.Answers) != 3 {
+					t.Errorf("%d answers, want a PTR per instance", len(m.Answers))
+				}
+			},
+		},
+		{
+			name: "instance",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(chipper, dnsmessage.TypeALL, false)}},
+			from: peer,
+			to:   group,
+			check: func(t *testing.T, m dnsmessage.Message) {
+				if len(m.Answers) != 2 {
+					t.Fatalf("%d answers, want SRV and TXT", len(m.Answers))
+				}
+				srv, ok := m.Answers[0].Body.(*dnsmessage.SRVResource)
+				if !ok || srv.Target != host || srv.Port != 443 {
+					t.Errorf("got %v, want SRV to %s:443", m.Answers[0], host)
+				}
+			},
+		},
+		{
+			name: "someone else's name",
+			msg:  dnsmessage.Message{Questions: []dnsmessage.Question{question(dnsmessage.MustNewName("printer.local."), dnsmessage.TypeA, false)}},
+			from: peer,
+		},
+		{
+			name:    "while probing",
+			msg:     dnsmessage.Message{Questions: []dnsmessage.Question{question(host, dnsmessage.TypeA, false)}},
+			from:    peer,
+			probing: true,
+		},
+		{
+			name: "response",
+			msg:  dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: []dnsmessage.Resource{aRecord(ours)}},
+			from: peer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testResponder(t)
+			r.probing.Store(tt.probing)
+			msg, to := r.handle(pack(t, tt.msg), tt.from)
+			if tt.to == nil {
+				if msg != nil {
+					t.Fatalf("got %v, want no reply", unpack(t, msg))
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("no reply")
+			}
+			if to.String() != tt.to.String() {
+				t.Errorf("sent to %s, want %s", to, tt.to)
+			}
+			m := unpack(t, msg)
+			if !m.Response || !m.Authoritative {
+				t.Error("want an authoritative response")
+			}
+			if tt.check != nil {
+				tt.check(t, m)
+			}
+		})
+	}
+}
+
+func TestGoodbye(t *testing.T) {
+	r := testResponder(t)
+	close(r.closed)
+	msg, err := r.build(0, r.allQuestions(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := unpack(t, msg)
+	// the A record, then a PTR, SRV and TXT per instance
+	if len(m.Answers) != 1+3*3 {
+		t.Errorf("%d records, want every one", len(m.Answers))
+	}
+	for _, a := range m.Answers {
+		if a.Header.TTL != 0 {
+			t.Errorf("%s TTL %d, want 0", a.Header.Name, a.Header.TTL)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	r := testResponder(t)
+	msg, err := r.buildProbe(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := unpack(t, msg)
+	if m.Response {
+		t.Error("a probe is a query")
+	}
+	// the host and three instances
+	if len(m.Questions) != 4 {
+		t.Errorf("%d questions, want 4", len(m.Questions))
+	}
+	for _, q := range m.Questions {
+		if q.Type != dnsmessage.TypeALL || q.Class&unicastResponse == 0 {
+			t.Errorf("got %v, want ANY with the QU bit", q)
+		}
+	}
+	if len(m.Authorities) != 1+3*2 {
+		t.Errorf("%d authorities, want the A record and SRV and TXT per instance", len(m.Authorities))
+	}
+	for _, a := range m.Authorities {
+		if a.Header.Class&cacheFlush != 0 {
+			t.Errorf("%s has the cache flush bit", a.Header.Name)
+		}
+	}
+}
+
+func TestConflict(t *testing.T) {
+	later := [4]byte{192, 168, 1, 200}
+	earlier := [4]byte{192, 168, 1, 5}
+	tests := []struct {
+		name string
+		msg  dnsmessage.Message
+		want bool
+	}{
+		{"our own answer", dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: []dnsmessage.Resource{aRecord(ours)}}, false},
+		{"another address", dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: []dnsmessage.Resource{aRecord(later)}}, true},
+		{"our own probe", probeMessage(ours), false},
+		// RFC 6762 8.2, the later data wins
+		{"probe with later data", probeMessage(later), true},
+		{"probe with earlier data", probeMessage(earlier), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testResponder(t)
+			r.probing.Store(true)
+			r.handle(pack(t, tt.msg), peer)
+			select {
+			case name := <-r.conflict:
+				if !tt.want {
+					t.Errorf("conflict on %s, want none", name)
+				} else if name != host.String() {
+					t.Errorf("conflict on %s, want %s", name, host)
+				}
+			default:
+				if tt.want {
+					t.Error("no conflict")
+				}
+			}
+		})
+	}
+}
+
+func TestLost(t *testing.T) {
+	r := testResponder(t)
+	other := dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Answers: []dnsmessage.Resource{aRecord([4]byte{192, 168, 1, 200})}}
+	r.handle(pack(t, other), peer)
+	if !r.lost.Load() {
+		t.Fatal("another machine answering for the host after probing should make us give it up")
+	}
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{question(host, dnsmessage.TypeA, false)}}
+	if msg, _ := r.handle(pack(t, query), peer); msg != nil {
+		t.Error("answered after giving the name up")
+	}
+}
+
+func probeMessage(ip [4]byte) dnsmessage.Message {
+	return dnsmessage.Message{
+		Questions:   []dnsmessage.Question{question(host, dnsmessage.TypeALL, true)},
+		Authorities: []dnsmessage.Resource{aRecord(ip)},
+	}
+}
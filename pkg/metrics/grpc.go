@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	GRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_grpc_requests_total",
+		Help: "gRPC calls by method and status code.",
+	}, []string{"method", "code"})
+	GRPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cavalier_grpc_duration_seconds",
+		Help: "gRPC call duration by method.",
+	}, []string{"method"})
+)
+
+func observeGRPC(method string, start time.Time, err error) {
+	GRPCRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	GRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// UnaryInterceptor counts and times unary calls. it goes before the quota interceptors,
+// so rejected calls are counted too
+func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeGRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+// StreamInterceptor counts and times streaming calls
+func StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeGRPC(info.FullMethod, start, err)
+	return err
+}
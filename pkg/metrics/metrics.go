@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// the metrics cavalier exports on /metrics. label values are kept to small fixed sets
+// (RPCs, outcomes, intents, stages), never ESNs or user IDs.
+
+const (
+	// an intent other than noaudio/unmatched was sent
+	OutcomeMatched   = "matched"
+	OutcomeUnmatched = "unmatched"
+	// nothing was said, or the audio was cut off by a stream limit
+	OutcomeNoAudio = "noaudio"
+	// answered by the knowledge graph (Houndify)
+	OutcomeKnowledge   = "knowledge"
+	OutcomeBlacklisted = "blacklisted"
+	// STT or sending the answer failed
+	OutcomeError = "error"
+	// the robot hung up before it got an answer
+	OutcomeNoResponse = "no_response"
+)
+
+// pipeline stages for StageDuration
+const (
+	StageSTT            = "stt"
+	StageIntentMatching = "intent_matching"
+	StageHoundify       = "houndify"
+	StageWeather        = "weather"
+)
+
+var (
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_requests_total",
+		Help: "Chipper requests by RPC, outcome and the intent that was sent.",
+	}, []string{"rpc", "outcome", "intent"})
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cavalier_request_duration_seconds",
+		Help: "Time from the first audio chunk to the answer, by RPC and outcome.",
+	}, []string{"rpc", "outcome"})
+	StageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cavalier_stage_duration_seconds",
+		Help: "Time spent in each stage of the voice pipeline.",
+	}, []string{"stage"})
+
+	ProviderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_provider_errors_total",
+		Help: "Failed calls to external providers (Houndify, weather and whisper APIs).",
+	}, []string{"provider"})
+
+	STTPoolOverflow = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_stt_pool_overflow_total",
+		Help: "Requests that found every STT recognizer busy.",
+	}, []string{"engine"})
+	STTPoolWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cavalier_stt_pool_wait_seconds",
+		Help: "Time spent waiting for a free STT recognizer.",
+	}, []string{"engine"})
+	STTPoolTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_stt_pool_timeouts_total",
+		Help: "Requests that gave up waiting for a free STT recognizer.",
+	}, []string{"engine"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cavalier_logins_total",
+		Help: "Account logins by result (success, failure, anonymous, household).",
+	}, []string{"result"})
+
+	DBDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cavalier_db_duration_seconds",
+		Help:    "Database operation latency, by database and operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"db", "op"})
+)
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]bool)
+)
+
+// RegisterSTTPool exports the size and use of an STT engine's recognizer pool. size and inUse are
+// read at every scrape, so engines that register again on a reload keep the first registration
+func RegisterSTTPool(engine string, size func() int, inUse func() int) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if pools[engine] {
+		return
+	}
+	pools[engine] = true
+	labels := prometheus.Labels{"engine": engine}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "cavalier_stt_pool_size",
+		Help:        "STT recognizers (or contexts) loaded.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(size()) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "cavalier_stt_pool_in_use",
+		Help:        "STT recognizers (or contexts) in use.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(inUse()) })
+}
+
+// ObserveStage records how long a pipeline stage took. made to be deferred:
+//
+//	defer metrics.ObserveStage(metrics.StageSTT, time.Now())
+func ObserveStage(stage string, start time.Time) {
+	StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDB records how long a database operation took, also made to be deferred
+func ObserveDB(db string, op string, start time.Time) {
+	DBDuration.WithLabelValues(db, op).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRequest counts a finished chipper request
+func ObserveRequest(rpc string, outcome string, intent string, start time.Time) {
+	Requests.WithLabelValues(rpc, outcome, intent).Inc()
+	RequestDuration.WithLabelValues(rpc, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the metrics above along with the Go runtime and process ones
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
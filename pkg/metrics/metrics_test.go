@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterSTTPool(t *testing.T) {
+	RegisterSTTPool("vosk", func() int { return 4 }, func() int { return 1 })
+	// a reload registers again, which must neither panic nor add a series
+	RegisterSTTPool("vosk", func() int { return 8 }, func() int { return 8 })
+	RegisterSTTPool("whisper", func() int { return 2 }, func() int { return 0 })
+
+	want := `
+# HELP cavalier_stt_pool_size STT recognizers (or contexts) loaded.
+# TYPE cavalier_stt_pool_size gauge
+cavalier_stt_pool_size{engine="vosk"} 4
+cavalier_stt_pool_size{engine="whisper"} 2
+# HELP cavalier_stt_pool_in_use STT recognizers (or contexts) in use.
+# TYPE cavalier_stt_pool_in_use gauge
+cavalier_stt_pool_in_use{engine="vosk"} 1
+cavalier_stt_pool_in_use{engine="whisper"} 0
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want),
+		"cavalier_stt_pool_size", "cavalier_stt_pool_in_use"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		observe func()
+		metric  prometheus.Collector
+		want    int
+	}{
+		{"request", func() { ObserveRequest("intent_graph", OutcomeMatched, "intent_clock_time", time.Now()) }, Requests, 1},
+		{"stage", func() { ObserveStage(StageSTT, time.Now()) }, StageDuration, 1},
+		{"db", func() { ObserveDB("users", "login", time.Now()) }, DBDuration, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.observe()
+			if got := testutil.CollectAndCount(tt.metric); got != tt.want {
+				t.Errorf("%d series, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, name := range []string{"go_goroutines", "process_start_time_seconds"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics is missing %s", name)
+		}
+	}
+}
@@ -1,56 +1,81 @@
 package processreqs
 
 import (
-	"fmt"
 	"strings"
+	"time"
 
+	"cavalier/pkg/metrics"
 	sr "cavalier/pkg/speechrequest"
 	ttr "cavalier/pkg/ttr"
 	"cavalier/pkg/vars"
 	"cavalier/pkg/vtt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // This is here for compatibility with 1.6 and older software
 func (s *Server) ProcessIntent(req *vtt.IntentRequest) (*vtt.IntentResponse, error) {
 	var successMatched bool
+	ctx, span := startRequestSpan(req.Ctx, "ProcessIntent", req.RequestID, req.Device)
+	defer span.End()
+	req.Ctx = ctx
 	speechReq := sr.ReqToSpeechRequest(req)
 	var transcribedText string
 
+	log := speechReq.Log()
+	speechReq.Language = requestLanguage(ctx, log, req.LangString, req.Device)
+	var outcome string
+	defer func() { observeRequest("intent", req.Time, outcome, req.Result) }()
+
 	// Check if ESN is blacklisted
 	if vars.IsESNBlacklisted(req.Device) {
-		fmt.Println("Blocked request from blacklisted ESN: " + req.Device)
-		return nil, fmt.Errorf("device is blacklisted")
+		log.Warn("blocked request from blacklisted ESN")
+		outcome = metrics.OutcomeBlacklisted
+		return nil, vars.ErrDeviceBlacklisted
+	}
+	if startRecording(&speechReq) {
+		defer func() { saveRecording("intent", speechReq, req.Time, transcribedText, req.Result) }()
 	}
 
-	if !isSti {
+	if intentEngine == nil {
 		var err error
-		transcribedText, err = sttHandler(speechReq)
+		sttStartTime := time.Now()
+		transcribedText, err = transcribe(ctx, speechReq)
+		metrics.ObserveStage(metrics.StageSTT, sttStartTime)
+		log.Info("stt done", "engine", VoiceProcessor, "duration", time.Since(sttStartTime), "text", transcribedText)
 		if err != nil {
-			ttr.IntentPass(req, "intent_system_noaudio", "voice processing error: "+err.Error(), map[string]string{"error": err.Error()}, true)
+			sttFailed(req, speechReq, err)
 			return nil, nil
 		}
 		if strings.TrimSpace(transcribedText) == "" {
 			ttr.IntentPass(req, "intent_system_noaudio", "", map[string]string{}, false)
 			return nil, nil
 		}
-		successMatched = ttr.ProcessTextAll(req, transcribedText, vars.IntentList, speechReq.IsOpus)
+		intentStartTime := time.Now()
+		matchCtx, matchSpan := otel.Tracer("cavalier").Start(ctx, "intent_matching")
+		req.Ctx = matchCtx
+		successMatched = ttr.ProcessTextAll(req, transcribedText, speechReq.Language, speechReq.IsOpus)
+		req.Ctx = ctx
+		matchSpan.SetAttributes(attribute.Bool("matched", successMatched))
+		matchSpan.End()
+		metrics.ObserveStage(metrics.StageIntentMatching, intentStartTime)
 	} else {
-		intent, slots, err := stiHandler(speechReq)
+		intent, slots, err := intentEngine.STI(speechReq)
 		if err != nil {
 			if err.Error() == "inference not understood" {
-				fmt.Println("No intent was matched")
+				log.Info("no intent was matched")
 				ttr.IntentPass(req, "intent_system_unmatched", "voice processing error", map[string]string{"error": err.Error()}, true)
 				return nil, nil
 			}
-			fmt.Println(err)
-			ttr.IntentPass(req, "intent_system_noaudio", "voice processing error", map[string]string{"error": err.Error()}, true)
+			sttFailed(req, speechReq, err)
 			return nil, nil
 		}
 		ttr.ParamCheckerSlotsEnUS(req, intent, slots, speechReq.IsOpus, speechReq.Device)
 		return nil, nil
 	}
 	if !successMatched {
-		// if vars.APIConfig.Knowledge.IntentGraph && vars.APIConfig.Knowledge.Enable {
+		// if vars.Config().Knowledge.IntentGraph && vars.Config().Knowledge.Enable {
 		// 	fmt.Println("Making LLM request for device " + req.Device + "...")
 		// 	_, err := ttr.StreamingKGSim(req, req.Device, transcribedText, false)
 		// 	if err != nil {
@@ -62,10 +87,10 @@ func (s *Server) ProcessIntent(req *vtt.IntentRequest) (*vtt.IntentResponse, err
 		// 	fmt.Println("Bot " + speechReq.Device + " request served.")
 		// 	return nil, nil
 		// }
-		// fmt.Println("No intent was matched.")
+		log.Info("no intent was matched")
 		ttr.IntentPass(req, "intent_system_unmatched", transcribedText, map[string]string{"": ""}, false)
 		return nil, nil
 	}
-	fmt.Println("Bot " + speechReq.Device + " request served.")
+	log.Info("request served", "duration", time.Since(req.Time))
 	return nil, nil
 }
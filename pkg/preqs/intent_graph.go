@@ -1,15 +1,18 @@
 package processreqs
 
 import (
-	"fmt"
 	"strings"
 	"time"
 
+	"cavalier/pkg/metrics"
 	"cavalier/pkg/vtt"
 
 	sr "cavalier/pkg/speechrequest"
 	ttr "cavalier/pkg/ttr"
 	"cavalier/pkg/vars"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var cantProcessIntent string = ""
@@ -20,33 +23,41 @@ func (s *Server) ProcessIntentGraph(req *vtt.IntentGraphRequest) (*vtt.IntentGra
 	requestStartTime := time.Now()
 
 	var successMatched bool
+	ctx, span := startRequestSpan(req.Ctx, "ProcessIntentGraph", req.RequestID, req.Device)
+	defer span.End()
+	req.Ctx = ctx
 	speechReq := sr.ReqToSpeechRequest(req)
 	var transcribedText string
 	var err error
+	log := speechReq.Log()
+	speechReq.Language = requestLanguage(ctx, log, req.LangString, req.Device)
+	var outcome string
+	defer func() { observeRequest("intent_graph", req.Time, outcome, req.Result) }()
 
 	// Check if ESN is blacklisted
 	if vars.IsESNBlacklisted(req.Device) {
-		fmt.Println("Blocked request from blacklisted ESN: " + req.Device)
-		fmt.Println("This person fucked up")
+		log.Warn("blocked request from blacklisted ESN", "stealth", vars.UseStealthBlacklist())
+		outcome = metrics.OutcomeBlacklisted
 
 		if !vars.UseStealthBlacklist() {
 			InitKnowledge() // Errors without this for whatever reason even though I think it should be inited already
-			fmt.Println(youFuckedUp)
 			ttr.KnowledgeGraphResponseIG(req, youFuckedUp, transcribedText)
 		}
-		fmt.Println("device is blacklisted")
 
 		return nil, nil
 	}
+	if startRecording(&speechReq) {
+		defer func() { saveRecording("intent_graph", speechReq, req.Time, transcribedText, req.Result) }()
+	}
 
-	if !isSti {
+	if intentEngine == nil {
 		sttStartTime := time.Now()
-		transcribedText, err = sttHandler(speechReq)
-		sttDuration := time.Since(sttStartTime)
-		fmt.Printf("Bot %s - STT took: %v\n", req.Device, sttDuration)
+		transcribedText, err = transcribe(ctx, speechReq)
+		metrics.ObserveStage(metrics.StageSTT, sttStartTime)
+		log.Info("stt done", "engine", VoiceProcessor, "duration", time.Since(sttStartTime), "text", transcribedText)
 
 		if err != nil {
-			ttr.IntentPass(req, "intent_system_noaudio", "voice processing error: "+err.Error(), map[string]string{"error": err.Error()}, true)
+			sttFailed(req, speechReq, err)
 			return nil, nil
 		}
 		if strings.TrimSpace(transcribedText) == "" {
@@ -55,20 +66,24 @@ func (s *Server) ProcessIntentGraph(req *vtt.IntentGraphRequest) (*vtt.IntentGra
 		}
 
 		intentStartTime := time.Now()
-		successMatched = ttr.ProcessTextAll(req, transcribedText, vars.IntentList, speechReq.IsOpus)
-		intentDuration := time.Since(intentStartTime)
-		fmt.Printf("Bot %s - Intent matching took: %v\n", req.Device, intentDuration)
+		matchCtx, matchSpan := otel.Tracer("cavalier").Start(ctx, "intent_matching")
+		req.Ctx = matchCtx
+		successMatched = ttr.ProcessTextAll(req, transcribedText, speechReq.Language, speechReq.IsOpus)
+		req.Ctx = ctx
+		matchSpan.SetAttributes(attribute.Bool("matched", successMatched))
+		matchSpan.End()
+		metrics.ObserveStage(metrics.StageIntentMatching, intentStartTime)
+		log.Info("intent matching done", "matched", successMatched, "duration", time.Since(intentStartTime))
 
 	} else {
-		intent, slots, err := stiHandler(speechReq)
+		intent, slots, err := intentEngine.STI(speechReq)
 		if err != nil {
 			if err.Error() == "inference not understood" {
-				fmt.Println("Bot " + speechReq.Device + " No intent was matched")
+				log.Info("no intent was matched")
 				ttr.IntentPass(req, "intent_system_unmatched", "voice processing error", map[string]string{"error": err.Error()}, true)
 				return nil, nil
 			}
-			fmt.Println(err)
-			ttr.IntentPass(req, "intent_system_noaudio", "voice processing error", map[string]string{"error": err.Error()}, true)
+			sttFailed(req, speechReq, err)
 			return nil, nil
 		}
 		ttr.ParamCheckerSlotsEnUS(req, intent, slots, speechReq.IsOpus, speechReq.Device)
@@ -76,46 +91,43 @@ func (s *Server) ProcessIntentGraph(req *vtt.IntentGraphRequest) (*vtt.IntentGra
 	}
 	if !successMatched {
 		// If knowledge graph is enabled, send to Houndify
-		if vars.APIConfig.Knowledge.Enable {
+		if !vtt.KnowledgeAllowed(req.Mode) {
+			log.Info("not forwarding unmatched request to Houndify", "mode", req.Mode.String())
+		} else if houndifyEnabled() {
 			if len([]rune(transcribedText)) >= 8 && !strings.Contains(transcribedText, "**") {
-				fmt.Println("No intent matched, forwarding to Houndify for device " + req.Device + "...")
+				log.Info("no intent matched, forwarding to Houndify")
 				InitKnowledge() // Errors without this for whatever reason even though I think it should be inited already
 
 				houndifyStartTime := time.Now()
-				apiResponse := houndifyTextRequest(transcribedText, req.Device, req.Session)
-				houndifyDuration := time.Since(houndifyStartTime)
-				fmt.Printf("Bot %s - Houndify request took: %v\n", req.Device, houndifyDuration)
+				apiResponse := houndifyTextRequest(ctx, log, transcribedText, req.Device, req.Session)
+				metrics.ObserveStage(metrics.StageHoundify, houndifyStartTime)
+				log.Info("houndify request done", "duration", time.Since(houndifyStartTime))
 
 				if apiResponse != "" && !strings.Contains(apiResponse, "not enabled") && !strings.Contains(apiResponse, "Knowledge graph is not enabled") && !strings.Contains(apiResponse, "Didn't get that!") {
 					if apiResponse == "" {
-						fmt.Println("Houndify intent graph returned error/empty, cancelling response")
+						log.Warn("houndify intent graph returned error/empty, cancelling response")
 						ttr.KnowledgeGraphResponseIG(req, cantProcessIntent, transcribedText)
-						totalDuration := time.Since(requestStartTime)
-						fmt.Printf("Bot %s - Total request time: %v\n", req.Device, totalDuration)
-						fmt.Println("Bot " + speechReq.Device + " request served via Houndify.")
+						outcome = metrics.OutcomeKnowledge
+						log.Info("request served via Houndify", "duration", time.Since(requestStartTime))
 						return nil, nil
 					}
 
 					ttr.KnowledgeGraphResponseIG(req, apiResponse, transcribedText)
-					totalDuration := time.Since(requestStartTime)
-					fmt.Printf("Bot %s - Total request time: %v\n", req.Device, totalDuration)
-					fmt.Println("Bot " + speechReq.Device + " request served via Houndify.")
+					outcome = metrics.OutcomeKnowledge
+					log.Info("request served via Houndify", "duration", time.Since(requestStartTime))
 					return nil, nil
 				}
 				// If Houndify fails or returns nothing useful, fall through to unmatched
-				fmt.Println("Houndify returned empty or error response")
+				log.Warn("houndify returned empty or error response")
 			} else {
-				fmt.Println("Intent Graph: Text too short to be worth sending to intent graph")
+				log.Debug("text too short to be worth sending to Houndify")
 			}
 		}
-		fmt.Println("No intent was matched.")
+		log.Info("no intent was matched")
 		ttr.IntentPass(req, "intent_system_unmatched", transcribedText, map[string]string{"": ""}, false)
-		totalDuration := time.Since(requestStartTime)
-		fmt.Printf("Bot %s - Total request time: %v\n", req.Device, totalDuration)
+		log.Info("request served", "duration", time.Since(requestStartTime))
 		return nil, nil
 	}
-	fmt.Println("Bot " + speechReq.Device + " request served.")
-	totalDuration := time.Since(requestStartTime)
-	fmt.Printf("Bot %s - Total request time: %v\n", req.Device, totalDuration)
+	log.Info("request served", "duration", time.Since(requestStartTime))
 	return nil, nil
 }
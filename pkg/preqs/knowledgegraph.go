@@ -1,18 +1,25 @@
 package processreqs
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"log/slog"
+	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
+	"cavalier/pkg/metrics"
 	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/tracing"
 	"cavalier/pkg/vars"
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
 	"github.com/pkg/errors"
 	"github.com/soundhound/houndify-sdk-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
 )
 
 var HKGclient houndify.Client
@@ -24,8 +31,7 @@ func ParseSpokenResponse(serverResponseJSON string) (string, error) {
 	result := make(map[string]interface{})
 	err := json.Unmarshal([]byte(serverResponseJSON), &result)
 	if err != nil {
-		fmt.Println(err.Error())
-		return "", errors.New("failed to decode json")
+		return "", errors.Wrap(err, "failed to decode json")
 	}
 	if !strings.EqualFold(result["Status"].(string), "OK") {
 		return "", errors.New(result["ErrorMessage"].(string))
@@ -36,19 +42,24 @@ func ParseSpokenResponse(serverResponseJSON string) (string, error) {
 	return result["AllResults"].([]interface{})[0].(map[string]interface{})["SpokenResponseLong"].(string), nil
 }
 
+// Houndify answers knowledge requests if it's enabled and has a key and ID.
+// a config without them is warned about when it's loaded
+func houndifyEnabled() bool {
+	knowledge := vars.Config().Knowledge
+	return knowledge.Enable && knowledge.Provider == "houndify" && knowledge.ID != "" && knowledge.Key != ""
+}
+
 func InitKnowledge() {
-	if vars.APIConfig.Knowledge.Enable && vars.APIConfig.Knowledge.Provider == "houndify" {
-		if vars.APIConfig.Knowledge.ID == "" || vars.APIConfig.Knowledge.Key == "" {
-			vars.APIConfig.Knowledge.Enable = false
-			fmt.Println("Houndify Client Key or ID was empty, not initializing kg client")
-		} else {
-			HKGclient = houndify.Client{
-				ClientID:  vars.APIConfig.Knowledge.ID,
-				ClientKey: vars.APIConfig.Knowledge.Key,
-			}
-			HKGclient.EnableConversationState()
-			fmt.Println("Initialized Houndify client")
+	if houndifyEnabled() {
+		knowledge := vars.Config().Knowledge
+		HKGclient = houndify.Client{
+			ClientID:  knowledge.ID,
+			ClientKey: knowledge.Key,
+			// client spans, and the trace passed on to Houndify
+			HttpClient: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
 		}
+		HKGclient.EnableConversationState()
+		slog.Debug("initialized houndify client")
 	}
 }
 
@@ -57,42 +68,59 @@ var NoResultSpoken string
 
 func houndifyKG(req sr.SpeechRequest) string {
 	var apiResponse string
-	if vars.APIConfig.Knowledge.Enable && vars.APIConfig.Knowledge.Provider == "houndify" {
-		fmt.Println("Sending request to Houndify...")
+	if houndifyEnabled() {
+		req.Log().Info("sending request to Houndify")
+		ctx, span := otel.Tracer("cavalier").Start(req.Context(), "houndify")
+		defer span.End()
+		req.Ctx = ctx
 		serverResponse := StreamAudioToHoundify(req, HKGclient)
-		apiResponse, _ = ParseSpokenResponse(serverResponse)
-		fmt.Println("Houndify response: " + apiResponse)
+		var err error
+		apiResponse, err = ParseSpokenResponse(serverResponse)
+		if err != nil {
+			req.Log().Warn("invalid houndify response", "error", err)
+			tracing.RecordError(span, err)
+		}
+		req.Log().Info("houndify response", "response", apiResponse)
 	} else {
 		apiResponse = "Houndify is not enabled."
-		fmt.Println("Houndify is not enabled.")
+		req.Log().Warn("houndify is not enabled")
 	}
 	return apiResponse
 }
 
 // Takes a SpeechRequest, figures out knowledgegraph provider, makes request, returns API response
 func KgRequest(req *vtt.KnowledgeGraphRequest, speechReq sr.SpeechRequest) string {
-	if vars.APIConfig.Knowledge.Enable {
-		if vars.APIConfig.Knowledge.Provider == "houndify" {
-			return houndifyKG(speechReq)
-		}
+	if houndifyEnabled() {
+		return houndifyKG(speechReq)
 	}
 	return "Knowledge graph is not enabled. This can be enabled in the web interface."
 }
 
 func (s *Server) ProcessKnowledgeGraph(req *vtt.KnowledgeGraphRequest) (*vtt.KnowledgeGraphResponse, error) {
 	InitKnowledge()
+	ctx, span := startRequestSpan(req.Ctx, "ProcessKnowledgeGraph", req.RequestID, req.Device)
+	defer span.End()
+	req.Ctx = ctx
 	speechReq := sr.ReqToSpeechRequest(req)
-	if vars.APIConfig.Knowledge.Enable && vars.APIConfig.Knowledge.Provider == "houndify" {
+	log := speechReq.Log()
+	outcome := metrics.OutcomeNoResponse
+	defer func() { metrics.ObserveRequest("knowledge_graph", outcome, "", req.Time) }()
+	// no mode check here: StreamingKnowledgeGraphRequest has no mode, so these are always
+	// VOICE_COMMAND. the intent graph checks vtt.KnowledgeAllowed before falling back to Houndify
+	if houndifyEnabled() {
+		houndifyStartTime := time.Now()
 		apiResponse := KgRequest(req, speechReq)
+		metrics.ObserveStage(metrics.StageHoundify, houndifyStartTime)
 
 		// Check if response is empty or contains error
 		var spokenResponse string
 		if apiResponse == "" || strings.TrimSpace(apiResponse) == "" || strings.Contains(apiResponse, "Didn't get that!") {
-			fmt.Println("Houndify knowledge graph returned error/empty, cancelling response")
+			log.Warn("houndify knowledge graph returned error/empty, cancelling response")
 			spokenResponse = cantProcessKnowledge
+			outcome = metrics.OutcomeUnmatched
 		} else {
 			spokenResponse = apiResponse
-			fmt.Println(spokenResponse)
+			outcome = metrics.OutcomeKnowledge
 		}
 
 		kg := pb.KnowledgeGraphResponse{
@@ -101,10 +129,12 @@ func (s *Server) ProcessKnowledgeGraph(req *vtt.KnowledgeGraphRequest) (*vtt.Kno
 			CommandType: NoResult,
 			SpokenText:  spokenResponse,
 		}
-		fmt.Println("(KG) Bot " + speechReq.Device + " request served.")
 		if err := req.Stream.Send(&kg); err != nil {
+			log.Error("failed to send knowledge graph response", "error", err)
+			outcome = metrics.OutcomeError
 			return nil, err
 		}
+		log.Info("knowledge graph request served", "duration", time.Since(req.Time))
 	}
 	return nil, nil
 
@@ -117,34 +147,42 @@ func cleanHoundifyResponse(response string) string {
 	return cleaned
 }
 
-func houndifyTextRequest(queryText string, device string, session string) string {
-	if !vars.APIConfig.Knowledge.Enable || vars.APIConfig.Knowledge.Provider != "houndify" {
+func houndifyTextRequest(ctx context.Context, log *slog.Logger, queryText string, device string, session string) string {
+	if !houndifyEnabled() {
 		return "Houndify is not enabled."
 	}
 
-	fmt.Println("Sending text request to Houndify...")
+	log.Debug("sending text request to Houndify")
+	ctx, span := otel.Tracer("cavalier").Start(ctx, "houndify")
+	defer span.End()
 
 	req := houndify.TextRequest{
 		Query:     queryText,
 		UserID:    device,
 		RequestID: session,
 	}
+	ctx, cancel := context.WithTimeout(ctx, vars.KnowledgeTimeout)
+	defer cancel()
+	req.WithContext(ctx)
 
 	serverResponse, err := HKGclient.TextSearch(req)
 	if err != nil {
-		fmt.Println("Error sending text request to Houndify:", err)
+		log.Error("error sending text request to Houndify", "error", err)
+		tracing.RecordError(span, err)
+		metrics.ProviderErrors.WithLabelValues("houndify").Inc()
 		return ""
 	}
 
 	apiResponse, err := ParseSpokenResponse(serverResponse)
 	if err != nil {
-		fmt.Println("Error parsing Houndify response:", err)
-		fmt.Println("Raw response:", serverResponse)
+		log.Error("error parsing houndify response", "error", err, "raw_response", serverResponse)
+		tracing.RecordError(span, err)
+		metrics.ProviderErrors.WithLabelValues("houndify").Inc()
 		return ""
 	}
 
 	apiResponse = cleanHoundifyResponse(apiResponse)
 
-	fmt.Println("Houndify response:", apiResponse)
+	log.Info("houndify response", "response", apiResponse)
 	return apiResponse
 }
@@ -0,0 +1,27 @@
+package processreqs
+
+import (
+	"context"
+	"log/slog"
+
+	lcztn "cavalier/pkg/localization"
+	"cavalier/pkg/vars"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// the language a request is transcribed and matched in, from what the robot sent and its settings
+func requestLanguage(ctx context.Context, log *slog.Logger, langString string, device string) string {
+	_, span := otel.Tracer("cavalier").Start(ctx, "request_language")
+	defer span.End()
+	settings, err := vars.GetRobotSettings("vic:" + device)
+	if err != nil && err != vars.ErrUserNotFound {
+		// the request still gets an answer, in the language LangString says or the default
+		log.Warn("failed to read robot settings for the request language", "error", err)
+	}
+	language := lcztn.RequestLanguage(langString, settings)
+	span.SetAttributes(attribute.String("language", language))
+	log.Debug("request language", "language", language, "lang_string", langString, "locale", settings.Locale)
+	return language
+}
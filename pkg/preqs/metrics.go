@@ -0,0 +1,34 @@
+package processreqs
+
+import (
+	"time"
+
+	"cavalier/pkg/metrics"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+// counts a finished request. the outcome comes from the intent that was sent,
+// unless the caller already knows it (blacklisted, knowledge graph answers)
+func observeRequest(rpc string, start time.Time, outcome string, result *pb.IntentResult) {
+	var intent string
+	if result != nil {
+		intent = result.Action
+	}
+	if outcome == "" {
+		switch intent {
+		case "":
+			outcome = metrics.OutcomeNoResponse
+		case "intent_system_noaudio":
+			outcome = metrics.OutcomeNoAudio
+			if result.Parameters["error"] != "" {
+				outcome = metrics.OutcomeError
+			}
+		case "intent_system_unmatched":
+			outcome = metrics.OutcomeUnmatched
+		default:
+			outcome = metrics.OutcomeMatched
+		}
+	}
+	metrics.ObserveRequest(rpc, outcome, intent, start)
+}
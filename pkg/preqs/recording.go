@@ -0,0 +1,43 @@
+package processreqs
+
+import (
+	"time"
+
+	"cavalier/pkg/recording"
+	sr "cavalier/pkg/speechrequest"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+// starts keeping a request's audio if its robot (or its owner) opted in to recording
+func startRecording(speechReq *sr.SpeechRequest) bool {
+	if !recording.Enabled(speechReq.Device) {
+		return false
+	}
+	speechReq.StartCapture()
+	return true
+}
+
+// writes a captured request out in the background, once its intent has been sent
+func saveRecording(rpc string, speechReq sr.SpeechRequest, start time.Time, transcript string, result *pb.IntentResult) {
+	if speechReq.Capture == nil {
+		return
+	}
+	ogg, pcm := speechReq.Capture.Audio()
+	meta := recording.Meta{
+		ESN:        speechReq.Device,
+		Session:    speechReq.Session,
+		Time:       start,
+		RPC:        rpc,
+		Language:   speechReq.Language,
+		Engine:     VoiceProcessor,
+		Transcript: transcript,
+	}
+	if result != nil {
+		meta.Intent = result.Action
+		meta.Params = result.Parameters
+	}
+	recording.SaveAsync(meta, ogg, pcm, func(err error) {
+		speechReq.Log().Error("recording failed", "error", err)
+	})
+}
@@ -1,9 +1,12 @@
 package processreqs
 
 import (
-	"fmt"
+	"errors"
+	"log/slog"
 
 	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/stt"
+	ttr "cavalier/pkg/ttr"
 	"cavalier/pkg/vars"
 )
 
@@ -18,55 +21,56 @@ type JsonIntent struct {
 	RequireExactMatch bool     `json:"requiresexact"`
 }
 
-var sttLanguage string = "en-US"
+// the STT engine in use
+var engine stt.Engine
 
-// speech-to-text
-var sttHandler func(sr.SpeechRequest) (string, error)
+// set when the engine goes straight to intents (like rhino), nil otherwise
+var intentEngine stt.IntentEngine
 
-// speech-to-intent (rhino)
-var stiHandler func(sr.SpeechRequest) (string, map[string]string, error)
-
-var isSti bool = false
-
-func ReloadVosk() {
-	if vars.APIConfig.STT.Service == "vosk" || vars.APIConfig.STT.Service == "whisper.cpp" {
-		vars.SttInitFunc()
-		vars.IntentList, _ = vars.LoadIntents()
+// answers a request whose transcription failed. audio cut off by a stream limit gets a plain noaudio,
+// a robot that hung up gets nothing since there is no one to answer
+func sttFailed(req interface{}, speechReq sr.SpeechRequest, err error) {
+	if speechReq.Context().Err() != nil {
+		speechReq.Log().Info("robot went away before transcription finished")
+		return
 	}
+	if sr.IsCutOff(err) {
+		speechReq.Log().Warn("audio cut off", "error", err)
+		ttr.IntentPass(req, "intent_system_noaudio", "", map[string]string{}, false)
+		return
+	}
+	speechReq.Log().Error("stt failed", "engine", VoiceProcessor, "error", err)
+	ttr.IntentPass(req, "intent_system_noaudio", "voice processing error: "+err.Error(), map[string]string{"error": err.Error()}, true)
 }
 
-// New returns a new server
-func New(InitFunc func() error, SttHandler interface{}, voiceProcessor string) (*Server, error) {
-
-	// Decide the TTS language
-	if voiceProcessor != "vosk" && voiceProcessor != "whisper.cpp" {
-		vars.APIConfig.STT.Language = "en-US"
+// New returns a new server, transcribing with e
+func New(e stt.Engine) (*Server, error) {
+	voiceProcessor := e.Name()
+	vars.UpdateConfig(func(c *vars.APIConfig) {
+		c.STT.Service = voiceProcessor
+		// Decide the TTS language
+		if !e.Capabilities().Multilingual {
+			c.STT.Language = "en-US"
+			c.STT.Languages = nil
+		}
+	})
+	languages := vars.Languages()
+	intents, err := vars.LoadAllIntents(languages)
+	if err != nil {
+		return nil, errors.New("New: failed to load intents: " + err.Error())
 	}
-	sttLanguage = vars.APIConfig.STT.Language
-	vars.IntentList, _ = vars.LoadIntents()
-	fmt.Println("Initiating " + voiceProcessor + " voice processor with language " + sttLanguage)
-	vars.SttInitFunc = InitFunc
-	err := InitFunc()
+	vars.SetIntents(intents)
+	slog.Info("initiating voice processor", "engine", voiceProcessor, "languages", languages)
+	vars.SttInitFunc = e.Init
+	err = e.Init(vars.Config())
 	if err != nil {
-		fmt.Println(err)
+		slog.Error("voice processor init failed", "engine", voiceProcessor, "error", err)
 		return nil, err
 	}
 
-	// SttHandler can either be `func(sr.SpeechRequest) (string, error)` or `func (sr.SpeechRequest) (string, map[string]string, error)`
-	// second one exists to accomodate Rhino
-
-	// check function type
-	if str, is := SttHandler.(func(sr.SpeechRequest) (string, error)); is {
-		sttHandler = str
-	} else if str, is := SttHandler.(func(sr.SpeechRequest) (string, map[string]string, error)); is {
-		stiHandler = str
-		isSti = true
-	} else {
-		return nil, fmt.Errorf("stthandler not of correct type")
-	}
-
-	// Initiating the chosen voice processor and load intents from json
+	engine = e
+	intentEngine, _ = e.(stt.IntentEngine)
 	VoiceProcessor = voiceProcessor
 
-	return &Server{}, err
+	return &Server{}, nil
 }
@@ -1,41 +1,49 @@
 package processreqs
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"time"
 
+	"cavalier/pkg/metrics"
 	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/vars"
 
 	"github.com/soundhound/houndify-sdk-go"
 )
 
 func StreamAudioToHoundify(sreq sr.SpeechRequest, client houndify.Client) string {
-	var err error
+	// the audio is bounded by the utterance deadline, Houndify gets KnowledgeTimeout on top of that to answer
+	ctx, cancel := context.WithDeadline(sreq.Context(), sreq.Deadline.Add(vars.KnowledgeTimeout))
+	defer cancel()
+
 	rp, wp := io.Pipe()
 	req := houndify.VoiceRequest{
 		AudioStream: rp,
 		UserID:      sreq.Device,
 		RequestID:   sreq.Session,
 	}
-	done := make(chan bool)
-	speechDone := false
+	req.WithContext(ctx)
+	done := make(chan struct{})
 	go func(wp *io.PipeWriter) {
-		defer wp.Close()
-
 		for {
 			select {
 			case <-done:
+				wp.Close()
 				return
 			default:
-				var chunk []byte
-				chunk, err = sreq.GetNextStreamChunkOpus()
-				speechDone, _ = sreq.DetectEndOfSpeech()
+				chunk, err := sreq.GetNextStreamChunkOpus()
 				if err != nil {
-					fmt.Println("End of stream")
+					sreq.Log().Debug("end of houndify audio stream", "error", err)
+					// fail the upload so a cut off utterance isn't answered
+					wp.CloseWithError(err)
+					cancel()
 					return
 				}
+				speechDone, _ := sreq.DetectEndOfSpeech()
 				wp.Write(chunk)
 				if speechDone {
+					wp.Close()
 					return
 				}
 			}
@@ -45,18 +53,26 @@ func StreamAudioToHoundify(sreq sr.SpeechRequest, client houndify.Client) string
 	partialTranscripts := make(chan houndify.PartialTranscript)
 	go func() {
 		for partial := range partialTranscripts {
-			if *partial.SafeToStopAudio {
-				fmt.Println("SafeToStopAudio received")
-				done <- true
-				return
+			if partial.SafeToStopAudio != nil && *partial.SafeToStopAudio {
+				sreq.Log().Debug("houndify SafeToStopAudio received")
+				close(done)
+				break
 			}
 		}
+		// the sdk closes the channel, keep draining so it doesn't block
+		for range partialTranscripts {
+		}
 	}()
 
+	start := time.Now()
 	serverResponse, err := client.VoiceSearch(req, partialTranscripts)
 	if err != nil {
-		fmt.Println(err)
-		fmt.Println(serverResponse)
+		if ctx.Err() != nil {
+			sreq.Log().Warn("houndify request cut off", "duration", time.Since(start), "error", err)
+			return ""
+		}
+		sreq.Log().Error("houndify voice search failed", "error", err, "raw_response", serverResponse)
+		metrics.ProviderErrors.WithLabelValues("houndify").Inc()
 	}
 	return serverResponse
 }
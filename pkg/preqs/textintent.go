@@ -0,0 +1,60 @@
+package processreqs
+
+import (
+	"strings"
+	"time"
+
+	"cavalier/pkg/logging"
+	"cavalier/pkg/metrics"
+	ttr "cavalier/pkg/ttr"
+	"cavalier/pkg/vars"
+	"cavalier/pkg/vtt"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProcessTextIntent runs the same intent matching and parameter extraction as voice requests, on text
+func (s *Server) ProcessTextIntent(req *vtt.TextIntentRequest) (*vtt.IntentResponse, error) {
+	log := logging.Request(req.RequestID, req.Device)
+	ctx, span := startRequestSpan(req.Ctx, "ProcessTextIntent", req.RequestID, req.Device)
+	defer span.End()
+	req.Ctx = ctx
+	var outcome string
+	defer func() {
+		var result *pb.IntentResult
+		if req.Response != nil {
+			result = req.Response.IntentResult
+		}
+		observeRequest("text_intent", req.Time, outcome, result)
+	}()
+	if vars.IsESNBlacklisted(req.Device) {
+		log.Warn("blocked text request from blacklisted ESN")
+		outcome = metrics.OutcomeBlacklisted
+		return nil, vars.ErrDeviceBlacklisted
+	}
+
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		ttr.IntentPass(req, "intent_system_noaudio", "", map[string]string{}, false)
+		return &vtt.IntentResponse{Intent: req.Response}, nil
+	}
+
+	language := requestLanguage(ctx, log, req.LangString, req.Device)
+	log.Info("text request", "text", text, "language", language)
+	// text requests come from apps and tools, not 0.10-era robots, so always use the modern param checker
+	intentStartTime := time.Now()
+	matchCtx, matchSpan := otel.Tracer("cavalier").Start(ctx, "intent_matching")
+	req.Ctx = matchCtx
+	matched := ttr.ProcessTextAll(req, text, language, true)
+	req.Ctx = ctx
+	matchSpan.SetAttributes(attribute.Bool("matched", matched))
+	matchSpan.End()
+	metrics.ObserveStage(metrics.StageIntentMatching, intentStartTime)
+	if !matched {
+		ttr.IntentPass(req, "intent_system_unmatched", text, map[string]string{"": ""}, false)
+	}
+	log.Info("text request served", "duration", time.Since(req.Time))
+	return &vtt.IntentResponse{Intent: req.Response}, nil
+}
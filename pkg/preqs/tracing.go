@@ -0,0 +1,30 @@
+package processreqs
+
+import (
+	"context"
+
+	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spans for the stages of a request. while a stage runs, the request's Ctx points at its span,
+// so the spans ttr and the STT engines start (robot settings, weather, VAD) land under it
+
+func startRequestSpan(ctx context.Context, name string, requestID string, device string) (context.Context, trace.Span) {
+	return otel.Tracer("cavalier").Start(ctx, name,
+		trace.WithAttributes(attribute.String("request_id", requestID), attribute.String("esn", device)))
+}
+
+// runs the STT engine under an "stt" span
+func transcribe(ctx context.Context, speechReq sr.SpeechRequest) (string, error) {
+	ctx, span := otel.Tracer("cavalier").Start(ctx, "stt", trace.WithAttributes(attribute.String("stt.engine", VoiceProcessor)))
+	defer span.End()
+	speechReq.Ctx = ctx
+	text, err := engine.STT(speechReq)
+	tracing.RecordError(span, err)
+	return text, err
+}
@@ -0,0 +1,317 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chipperpb "github.com/digital-dream-labs/api/go/chipperpb"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// concurrency and rate limits for the gRPC services (chipper, token, jdocs), so one robot
+// can't open unlimited voice streams and take every recognizer
+
+// Policy is the set of limits for one method or service. Zero means no limit.
+type Policy struct {
+	// calls in flight across all robots
+	MaxConcurrent int `json:"max_concurrent"`
+	// calls in flight for one robot
+	MaxConcurrentPerESN int `json:"max_concurrent_per_esn"`
+	// new calls per second for one robot, with bursts up to RateBurst
+	RatePerESN float64 `json:"rate_per_esn"`
+	RateBurst  int     `json:"rate_burst"`
+}
+
+// policies are looked up by full method name ("/chippergrpc2.ChipperGrpc/StreamingIntentGraph"),
+// then by service ("/chippergrpc2.ChipperGrpc/"), then "default"
+func DefaultPolicies() map[string]Policy {
+	// every voice stream holds a recognizer, there is one per CPU
+	voice := Policy{
+		MaxConcurrent:       2 * runtime.NumCPU(),
+		MaxConcurrentPerESN: 2,
+		RatePerESN:          1,
+		RateBurst:           5,
+	}
+	chipper := "/" + chipperpb.ChipperGrpc_ServiceDesc.ServiceName + "/"
+	return map[string]Policy{
+		chipper + "StreamingIntent":         voice,
+		chipper + "StreamingIntentGraph":    voice,
+		chipper + "StreamingKnowledgeGraph": voice,
+		chipper: {
+			MaxConcurrentPerESN: 2,
+			RatePerESN:          2,
+			RateBurst:           10,
+		},
+		"default": {
+			MaxConcurrentPerESN: 8,
+			RatePerESN:          10,
+			RateBurst:           30,
+		},
+	}
+}
+
+// per-robot entries that have been idle this long are dropped
+var idleExpiry = 10 * time.Minute
+
+type client struct {
+	active   int
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type bucket struct {
+	name     string
+	policy   Policy
+	active   int64
+	rejected uint64
+	mu       sync.Mutex
+	clients  map[string]*client
+}
+
+type Limiter struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+	buckets  map[string]*bucket
+}
+
+type BucketStats struct {
+	Policy   Policy `json:"policy"`
+	Active   int64  `json:"active"`
+	Clients  int    `json:"clients"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// New makes a limiter with the given policies. A nil map uses DefaultPolicies.
+func New(policies map[string]Policy) *Limiter {
+	if policies == nil {
+		policies = DefaultPolicies()
+	}
+	l := &Limiter{
+		policies: policies,
+		buckets:  make(map[string]*bucket),
+	}
+	go l.expirer()
+	return l
+}
+
+// Load reads policies from a JSON file of the same shape as DefaultPolicies,
+// on top of the defaults. A missing file just means the defaults.
+func Load(path string) (map[string]Policy, error) {
+	policies := DefaultPolicies()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policies, nil
+		}
+		return nil, errors.New("quota.Load: " + err.Error())
+	}
+	var custom map[string]Policy
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, errors.New("quota.Load: failed to parse " + path + ": " + err.Error())
+	}
+	for name, p := range custom {
+		if p.MaxConcurrent < 0 || p.MaxConcurrentPerESN < 0 || p.RatePerESN < 0 || p.RateBurst < 0 {
+			return nil, errors.New("quota.Load: negative limit in policy " + name)
+		}
+		if p.RatePerESN > 0 && p.RateBurst == 0 {
+			p.RateBurst = 1
+		}
+		policies[name] = p
+	}
+	slog.Info("loaded quota policies", "count", len(custom), "path", path)
+	return policies, nil
+}
+
+func (l *Limiter) bucketFor(method string) *bucket {
+	name := "default"
+	if _, ok := l.policies[method]; ok {
+		name = method
+	} else if i := strings.LastIndex(method, "/"); i > 0 {
+		if _, ok := l.policies[method[:i+1]]; ok {
+			name = method[:i+1]
+		}
+	}
+	l.mu.RLock()
+	b, ok := l.buckets[name]
+	l.mu.RUnlock()
+	if ok {
+		return b
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[name]; ok {
+		return b
+	}
+	b = &bucket{name: name, policy: l.policies[name], clients: make(map[string]*client)}
+	l.buckets[name] = b
+	return b
+}
+
+func (b *bucket) reject(msg string) error {
+	atomic.AddUint64(&b.rejected, 1)
+	return status.Error(codes.ResourceExhausted, msg)
+}
+
+func (b *bucket) acquireGlobal(method string) error {
+	if n := atomic.AddInt64(&b.active, 1); b.policy.MaxConcurrent > 0 && n > int64(b.policy.MaxConcurrent) {
+		atomic.AddInt64(&b.active, -1)
+		slog.Warn("quota at its global limit", "method", method, "policy", b.name)
+		return b.reject("server is busy, try again later")
+	}
+	return nil
+}
+
+func (b *bucket) releaseGlobal() {
+	atomic.AddInt64(&b.active, -1)
+}
+
+func (b *bucket) acquire(method, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.clients[key]
+	if !ok {
+		c = &client{}
+		if b.policy.RatePerESN > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(b.policy.RatePerESN), b.policy.RateBurst)
+		}
+		b.clients[key] = c
+	}
+	c.lastSeen = time.Now()
+	if b.policy.MaxConcurrentPerESN > 0 && c.active >= b.policy.MaxConcurrentPerESN {
+		slog.Warn("too many concurrent calls from one robot", "method", method, "esn", key, "policy", b.name)
+		return b.reject("too many concurrent requests from this device")
+	}
+	if c.limiter != nil && !c.limiter.Allow() {
+		slog.Warn("robot over the rate limit", "method", method, "esn", key, "policy", b.name)
+		return b.reject("rate limit exceeded")
+	}
+	c.active++
+	return nil
+}
+
+func (b *bucket) release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.clients[key]; ok {
+		c.active--
+		c.lastSeen = time.Now()
+	}
+}
+
+func (l *Limiter) expirer() {
+	for {
+		time.Sleep(time.Minute)
+		l.mu.RLock()
+		for _, b := range l.buckets {
+			b.mu.Lock()
+			for key, c := range b.clients {
+				if c.active == 0 && time.Since(c.lastSeen) > idleExpiry {
+					delete(b.clients, key)
+				}
+			}
+			b.mu.Unlock()
+		}
+		l.mu.RUnlock()
+	}
+}
+
+func (l *Limiter) Stats() map[string]BucketStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	stats := make(map[string]BucketStats)
+	for name, b := range l.buckets {
+		b.mu.Lock()
+		clients := len(b.clients)
+		b.mu.Unlock()
+		stats[name] = BucketStats{
+			Policy:   b.policy,
+			Active:   atomic.LoadInt64(&b.active),
+			Clients:  clients,
+			Rejected: atomic.LoadUint64(&b.rejected),
+		}
+	}
+	return stats
+}
+
+// the robot a message came from. chipper requests carry a device ID and jdocs requests a thing,
+// anything else (token requests) is keyed by the peer's address
+func keyFor(ctx context.Context, msg interface{}) string {
+	if m, ok := msg.(interface{ GetDeviceId() string }); ok && m.GetDeviceId() != "" {
+		return "esn:" + strings.TrimPrefix(strings.ToLower(m.GetDeviceId()), "vic:")
+	}
+	if m, ok := msg.(interface{ GetThing() string }); ok && m.GetThing() != "" {
+		return "esn:" + strings.TrimPrefix(strings.ToLower(m.GetThing()), "vic:")
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if i := strings.LastIndex(addr, ":"); i > 0 {
+			addr = addr[:i]
+		}
+		return "ip:" + addr
+	}
+	return "unknown"
+}
+
+func (l *Limiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	b := l.bucketFor(info.FullMethod)
+	if err := b.acquireGlobal(info.FullMethod); err != nil {
+		return nil, err
+	}
+	defer b.releaseGlobal()
+	key := keyFor(ctx, req)
+	if err := b.acquire(info.FullMethod, key); err != nil {
+		return nil, err
+	}
+	defer b.release(key)
+	return handler(ctx, req)
+}
+
+// quotaStream holds off on the per-robot limits until the first message, which is where
+// chipper streams say which robot they are
+type quotaStream struct {
+	grpc.ServerStream
+	b      *bucket
+	method string
+	key    string
+}
+
+func (s *quotaStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.key == "" {
+		key := keyFor(s.Context(), m)
+		if err := s.b.acquire(s.method, key); err != nil {
+			return err
+		}
+		s.key = key
+	}
+	return nil
+}
+
+func (l *Limiter) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	b := l.bucketFor(info.FullMethod)
+	if err := b.acquireGlobal(info.FullMethod); err != nil {
+		return err
+	}
+	defer b.releaseGlobal()
+	qs := &quotaStream{ServerStream: ss, b: b, method: info.FullMethod}
+	defer func() {
+		if qs.key != "" {
+			b.release(qs.key)
+		}
+	}()
+	return handler(srv, qs)
+}
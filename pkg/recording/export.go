@@ -0,0 +1,110 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cavalier/pkg/vars"
+)
+
+type ExportOptions struct {
+	// only recordings after this, zero for all
+	Since time.Time
+	// only these intents, empty for all
+	Intents []string
+	// only this robot, empty for all
+	ESN string
+	// copy the original Ogg streams too
+	WithOgg bool
+}
+
+// one line of metadata.jsonl
+type ExportEntry struct {
+	Audio      string            `json:"audio"`
+	Ogg        string            `json:"ogg,omitempty"`
+	Transcript string            `json:"transcript"`
+	Intent     string            `json:"intent"`
+	Params     map[string]string `json:"params,omitempty"`
+	Language   string            `json:"language"`
+	Engine     string            `json:"engine"`
+	ESN        string            `json:"esn"`
+	Time       time.Time         `json:"time"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// Export writes a labelled dataset to outDir: the WAVs under audio/ and one JSON line per
+// recording in metadata.jsonl. It returns the number of recordings per intent.
+func Export(outDir string, opts ExportOptions) (map[string]int, error) {
+	names, err := List()
+	if err != nil {
+		return nil, errors.New("recording.Export: " + err.Error())
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, "audio"), 0755); err != nil {
+		return nil, errors.New("recording.Export: " + err.Error())
+	}
+	metaOut, err := os.Create(filepath.Join(outDir, "metadata.jsonl"))
+	if err != nil {
+		return nil, errors.New("recording.Export: " + err.Error())
+	}
+	defer metaOut.Close()
+	enc := json.NewEncoder(metaOut)
+
+	wantIntent := make(map[string]bool)
+	for _, intent := range opts.Intents {
+		wantIntent[intent] = true
+	}
+	counts := make(map[string]int)
+	for _, name := range names {
+		dir := filepath.Join(vars.RecordingsPath, name)
+		metaBytes, err := os.ReadFile(filepath.Join(dir, MetaFile))
+		if err != nil {
+			// half-written or pruned while we were going
+			continue
+		}
+		var meta Meta
+		if err := json.Unmarshal(metaBytes, &meta); err != nil {
+			continue
+		}
+		if meta.Time.Before(opts.Since) ||
+			(len(wantIntent) > 0 && !wantIntent[meta.Intent]) ||
+			(opts.ESN != "" && vars.Thingifier(opts.ESN) != vars.Thingifier(meta.ESN)) {
+			continue
+		}
+		entry := ExportEntry{
+			Audio:      filepath.Join("audio", name+".wav"),
+			Transcript: meta.Transcript,
+			Intent:     meta.Intent,
+			Params:     meta.Params,
+			Language:   meta.Language,
+			Engine:     meta.Engine,
+			ESN:        meta.ESN,
+			Time:       meta.Time,
+			DurationMs: meta.DurationMs,
+		}
+		if err := copyFile(filepath.Join(dir, WavFile), filepath.Join(outDir, entry.Audio)); err != nil {
+			continue
+		}
+		if opts.WithOgg && meta.HasOgg {
+			entry.Ogg = filepath.Join("audio", name+".ogg")
+			if err := copyFile(filepath.Join(dir, OggFile), filepath.Join(outDir, entry.Ogg)); err != nil {
+				entry.Ogg = ""
+			}
+		}
+		if err := enc.Encode(entry); err != nil {
+			return nil, errors.New("recording.Export: " + err.Error())
+		}
+		counts[meta.Intent]++
+	}
+	return counts, nil
+}
+
+func copyFile(src string, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
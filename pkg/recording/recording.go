@@ -0,0 +1,307 @@
+package recording
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cavalier/pkg/users"
+	"cavalier/pkg/vars"
+)
+
+// opt-in recording of voice requests, for tuning intents and STT models.
+// each recording is a directory under vars.RecordingsPath:
+//   <time>_<esn>_<session>/audio.ogg   raw stream from the robot (opus streams only)
+//   <time>_<esn>_<session>/audio.wav   16000 Hz mono PCM that went to STT
+//   <time>_<esn>_<session>/meta.json   transcript, intent, params
+
+const (
+	KindRobot   = "robot"
+	KindAccount = "account"
+
+	MetaFile = "meta.json"
+	OggFile  = "audio.ogg"
+	WavFile  = "audio.wav"
+
+	timeLayout = "20060102T150405.000Z"
+)
+
+var db *sql.DB
+
+// held while writing or pruning, so the size count stays right
+var dirMu sync.Mutex
+var totalBytes int64 = -1
+
+// saves still being written, see SaveAsync
+var pending sync.WaitGroup
+
+type Meta struct {
+	ESN        string            `json:"esn"`
+	Session    string            `json:"session"`
+	Time       time.Time         `json:"time"`
+	RPC        string            `json:"rpc"`
+	Language   string            `json:"language"`
+	Engine     string            `json:"engine"`
+	Transcript string            `json:"transcript"`
+	Intent     string            `json:"intent"`
+	Params     map[string]string `json:"params,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	HasOgg     bool              `json:"has_ogg"`
+}
+
+func Init(jdocsDB *sql.DB) {
+	_, err := jdocsDB.Exec(`
+		CREATE TABLE IF NOT EXISTS recording_optins (
+			kind TEXT NOT NULL,
+			id TEXT NOT NULL,
+			created INTEGER NOT NULL,
+			PRIMARY KEY (kind, id)
+		);
+	`)
+	if err != nil {
+		panic("failed to initialize recording_optins table: " + err.Error())
+	}
+	db = jdocsDB
+	go janitor()
+}
+
+// SetOptIn turns recording on or off for a robot ("vic:<esn>") or an account (user ID)
+func SetOptIn(kind string, id string, enabled bool) error {
+	if kind != KindRobot && kind != KindAccount {
+		return errors.New("SetOptIn: unknown kind " + kind)
+	}
+	var err error
+	if enabled {
+		_, err = db.Exec("INSERT OR IGNORE INTO recording_optins (kind, id, created) VALUES (?, ?, ?)", kind, id, time.Now().Unix())
+	} else {
+		_, err = db.Exec("DELETE FROM recording_optins WHERE kind = ? AND id = ?", kind, id)
+	}
+	if err != nil {
+		return errors.New("SetOptIn: " + err.Error())
+	}
+	return nil
+}
+
+func isOptedIn(kind string, id string) bool {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM recording_optins WHERE kind = ? AND id = ?", kind, id).Scan(&count); err != nil {
+		slog.Warn("recording opt-in lookup failed", "kind", kind, "id", id, "error", err)
+		return false
+	}
+	return count > 0
+}
+
+// IsOptedIn reports whether a robot or account has opted in itself, not counting its owners
+func IsOptedIn(kind string, id string) bool {
+	if db == nil {
+		return false
+	}
+	return isOptedIn(kind, id)
+}
+
+// Enabled reports whether a robot's requests should be recorded, either because it opted in
+// or because an account it belongs to did
+func Enabled(esn string) bool {
+	if db == nil || vars.RecordingMaxBytes <= 0 {
+		return false
+	}
+	thing := vars.Thingifier(esn)
+	if isOptedIn(KindRobot, thing) {
+		return true
+	}
+	userIDs, err := users.GetUsersForRobot(thing)
+	if err != nil {
+		slog.Warn("couldn't look up a robot's owners for recording", "esn", esn, "error", err)
+		return false
+	}
+	for _, userID := range userIDs {
+		if isOptedIn(KindAccount, userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveAsync writes a recording in the background so the robot isn't kept waiting on the disk.
+// onError is called if it fails.
+func SaveAsync(meta Meta, ogg []byte, pcm []byte, onError func(error)) {
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		if err := Save(meta, ogg, pcm); err != nil && onError != nil {
+			onError(err)
+		}
+	}()
+}
+
+// Wait blocks until the recordings being saved in the background are written, or ctx is done
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("recording.Wait: " + ctx.Err().Error())
+	}
+}
+
+// Save writes one recording. ogg may be empty, pcm is 16000 Hz mono.
+func Save(meta Meta, ogg []byte, pcm []byte) error {
+	if len(pcm) == 0 {
+		return errors.New("recording.Save: no audio")
+	}
+	meta.HasOgg = len(ogg) > 0
+	meta.DurationMs = int64(len(pcm)) * 1000 / (16000 * 2)
+	name := strings.Join([]string{
+		meta.Time.UTC().Format(timeLayout),
+		safeName(strings.TrimPrefix(vars.Thingifier(meta.ESN), "vic:")),
+		safeName(meta.Session),
+	}, "_")
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return errors.New("recording.Save: " + err.Error())
+	}
+
+	dirMu.Lock()
+	defer dirMu.Unlock()
+	dir := filepath.Join(vars.RecordingsPath, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.New("recording.Save: " + err.Error())
+	}
+	files := map[string][]byte{WavFile: WAVBytes(pcm), MetaFile: metaBytes}
+	if meta.HasOgg {
+		files[OggFile] = ogg
+	}
+	var written int64
+	for file, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			os.RemoveAll(dir)
+			return errors.New("recording.Save: " + err.Error())
+		}
+		written += int64(len(data))
+	}
+	if totalBytes >= 0 {
+		totalBytes += written
+		if totalBytes <= vars.RecordingMaxBytes {
+			// retention is left to the janitor
+			return nil
+		}
+	}
+	return prune()
+}
+
+// keeps ids from escaping the recordings directory
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+type recDir struct {
+	name  string
+	bytes int64
+	time  time.Time
+}
+
+// List returns every recording directory name, oldest first
+func List() ([]string, error) {
+	dirs, err := listDirs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(dirs))
+	for i, d := range dirs {
+		names[i] = d.name
+	}
+	return names, nil
+}
+
+func listDirs() ([]recDir, error) {
+	entries, err := os.ReadDir(vars.RecordingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dirs []recDir
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t, err := time.Parse(timeLayout, strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			continue
+		}
+		d := recDir{name: e.Name(), time: t}
+		files, _ := os.ReadDir(filepath.Join(vars.RecordingsPath, e.Name()))
+		for _, f := range files {
+			if info, err := f.Info(); err == nil {
+				d.bytes += info.Size()
+			}
+		}
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].name < dirs[j].name })
+	return dirs, nil
+}
+
+// drops recordings older than vars.RecordingRetention, then the oldest ones until the total is
+// under vars.RecordingMaxBytes. dirMu must be held.
+func prune() error {
+	dirs, err := listDirs()
+	if err != nil {
+		return errors.New("recording.prune: " + err.Error())
+	}
+	var total int64
+	for _, d := range dirs {
+		total += d.bytes
+	}
+	removed := 0
+	for _, d := range dirs {
+		expired := vars.RecordingRetention > 0 && time.Since(d.time) > vars.RecordingRetention
+		if !expired && total <= vars.RecordingMaxBytes {
+			break
+		}
+		if err := os.RemoveAll(filepath.Join(vars.RecordingsPath, d.name)); err != nil {
+			return errors.New("recording.prune: " + err.Error())
+		}
+		total -= d.bytes
+		removed++
+	}
+	totalBytes = total
+	if removed > 0 {
+		slog.Info("pruned recordings", "removed", removed, "bytes_left", total)
+	}
+	return nil
+}
+
+func janitor() {
+	for {
+		dirMu.Lock()
+		if err := prune(); err != nil {
+			slog.Warn("pruning recordings failed", "error", err)
+		}
+		dirMu.Unlock()
+		time.Sleep(time.Hour)
+	}
+}
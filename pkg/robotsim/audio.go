@@ -0,0 +1,161 @@
+package robotsim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+const sampleRate = 16000
+
+// Audio is a file split up the way a robot streams it
+type Audio struct {
+	Encoding pb.AudioEncoding
+	Chunks   [][]byte
+	// how long each chunk lasts, for playing it in real time
+	Durations []time.Duration
+}
+
+// LoadAudio reads a .pcm (16000 Hz mono s16le), .wav or .ogg (Ogg Opus) file.
+// PCM and WAV are cut into chunkMs chunks and followed by padMs of silence, like a robot
+// that keeps listening after the speech ends. Ogg is sent a page at a time.
+func LoadAudio(path string, chunkMs int, padMs int) (Audio, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Audio{}, errors.New("LoadAudio: " + err.Error())
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pcm", ".raw":
+		return pcmAudio(data, chunkMs, padMs), nil
+	case ".wav":
+		pcm, err := wavPCM(data)
+		if err != nil {
+			return Audio{}, errors.New("LoadAudio: " + path + ": " + err.Error())
+		}
+		return pcmAudio(pcm, chunkMs, padMs), nil
+	case ".ogg", ".opus":
+		audio, err := oggAudio(data)
+		if err != nil {
+			return Audio{}, errors.New("LoadAudio: " + path + ": " + err.Error())
+		}
+		return audio, nil
+	}
+	return Audio{}, errors.New("LoadAudio: unknown audio type " + filepath.Ext(path))
+}
+
+func pcmAudio(pcm []byte, chunkMs int, padMs int) Audio {
+	if chunkMs <= 0 {
+		chunkMs = 100
+	}
+	pcm = append(pcm, make([]byte, padMs*sampleRate/1000*2)...)
+	chunkLen := chunkMs * sampleRate / 1000 * 2
+	audio := Audio{Encoding: pb.AudioEncoding_LINEAR_PCM}
+	for len(pcm) > 0 {
+		n := chunkLen
+		if n > len(pcm) {
+			n = len(pcm)
+		}
+		audio.Chunks = append(audio.Chunks, pcm[:n])
+		audio.Durations = append(audio.Durations, time.Duration(n/2)*time.Second/sampleRate)
+		pcm = pcm[n:]
+	}
+	return audio
+}
+
+// pulls the samples out of a 16000 Hz mono 16-bit WAV
+func wavPCM(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var formatOK bool
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			size = len(body)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			format := binary.LittleEndian.Uint16(body[0:2])
+			channels := binary.LittleEndian.Uint16(body[2:4])
+			rate := binary.LittleEndian.Uint32(body[4:8])
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			if format != 1 || channels != 1 || rate != sampleRate || bits != 16 {
+				return nil, errors.New("WAV must be 16000 Hz mono 16-bit PCM")
+			}
+			formatOK = true
+		case "data":
+			if !formatOK {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			return body[:size], nil
+		}
+		// chunks are padded to an even length
+		pos += 8 + size + size%2
+	}
+	return nil, errors.New("no data chunk")
+}
+
+// splits an Ogg stream into its pages
+func oggAudio(data []byte) (Audio, error) {
+	audio := Audio{Encoding: pb.AudioEncoding_OGG_OPUS}
+	var lastGranule uint64
+	for len(data) > 0 {
+		if len(data) < 27 || !bytes.Equal(data[0:4], []byte("OggS")) {
+			return Audio{}, errors.New("not an Ogg stream, or a truncated one")
+		}
+		nSegs := int(data[26])
+		if len(data) < 27+nSegs {
+			return Audio{}, errors.New("truncated Ogg page")
+		}
+		pageLen := 27 + nSegs
+		for _, seg := range data[27 : 27+nSegs] {
+			pageLen += int(seg)
+		}
+		if len(data) < pageLen {
+			return Audio{}, errors.New("truncated Ogg page")
+		}
+		// opus granule positions are in 48 kHz samples. header pages have 0
+		granule := binary.LittleEndian.Uint64(data[6:14])
+		var dur time.Duration
+		if granule > lastGranule && granule != ^uint64(0) {
+			dur = time.Duration(granule-lastGranule) * time.Second / 48000
+			lastGranule = granule
+		}
+		audio.Chunks = append(audio.Chunks, data[:pageLen])
+		audio.Durations = append(audio.Durations, dur)
+		data = data[pageLen:]
+	}
+	if len(audio.Chunks) == 0 {
+		return Audio{}, errors.New("empty Ogg stream")
+	}
+	return audio, nil
+}
+
+// LanguageCode maps a locale like "en-US" or "de-DE" to the robot's language code. the robot has
+// no code for other locales and sends ENGLISH_US, leaving the server to go by its settings
+// locale, so they map to that too
+func LanguageCode(locale string) pb.LanguageCode {
+	switch strings.ToLower(strings.ReplaceAll(locale, "_", "-")) {
+	case "en-gb", "en-uk":
+		return pb.LanguageCode_ENGLISH_UK
+	case "en-au":
+		return pb.LanguageCode_ENGLISH_AU
+	case "de-de", "de":
+		return pb.LanguageCode_GERMAN
+	case "fr-fr", "fr":
+		return pb.LanguageCode_FRENCH
+	}
+	return pb.LanguageCode_ENGLISH_US
+}
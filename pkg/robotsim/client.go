@@ -0,0 +1,256 @@
+package robotsim
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"cavalier/pkg/vars"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// a fake robot for exercising a chipper server without a Vector
+
+type Config struct {
+	// chipper address, host:port
+	Addr string
+	// don't verify the server's certificate
+	InsecureSkipVerify bool
+	// trust this CA instead of the system pool
+	CAFile string
+	// no TLS at all
+	Plaintext bool
+
+	DeviceID string
+	Language pb.LanguageCode
+	Mode     pb.RobotMode
+	// send chunks as fast as the robot would record them instead of all at once
+	Realtime bool
+	// per request, 30s if 0
+	Timeout time.Duration
+}
+
+// Result is what chipper answered with
+type Result struct {
+	RPC         string            `json:"rpc"`
+	Session     string            `json:"session"`
+	Intent      string            `json:"intent"`
+	Params      map[string]string `json:"params,omitempty"`
+	QueryText   string            `json:"query_text,omitempty"`
+	SpokenText  string            `json:"spoken_text,omitempty"`
+	CommandType string            `json:"command_type,omitempty"`
+	Duration    time.Duration     `json:"duration"`
+}
+
+type Client struct {
+	cfg     Config
+	conn    *grpc.ClientConn
+	chipper pb.ChipperGrpcClient
+}
+
+func Dial(cfg Config) (*Client, error) {
+	if cfg.DeviceID == "" {
+		cfg.DeviceID = "00e20100"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	var creds credentials.TransportCredentials
+	if cfg.Plaintext {
+		creds = insecure.NewCredentials()
+	} else {
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.CAFile != "" {
+			ca, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, errors.New("robotsim.Dial: " + err.Error())
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, errors.New("robotsim.Dial: no certificates in " + cfg.CAFile)
+			}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(cfg.Addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.New("robotsim.Dial: " + err.Error())
+	}
+	return &Client{cfg: cfg, conn: conn, chipper: pb.NewChipperGrpcClient(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// sends every chunk, then closes the send side. stops early once ctx is done,
+// which is how the caller says an answer has come back
+func (c *Client) play(ctx context.Context, audio Audio, send func([]byte) error, closeSend func() error) error {
+	for i, chunk := range audio.Chunks {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := send(chunk); err != nil {
+			if err == io.EOF {
+				// the server has answered and hung up, Recv gets the reason
+				return nil
+			}
+			return err
+		}
+		if c.cfg.Realtime && audio.Durations[i] > 0 {
+			select {
+			case <-time.After(audio.Durations[i]):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+	return closeSend()
+}
+
+func resultFromIntent(r *pb.IntentResult, res *Result) {
+	if r == nil {
+		return
+	}
+	res.Intent = r.Action
+	res.Params = r.Parameters
+	res.QueryText = r.QueryText
+}
+
+// IntentGraph streams audio to StreamingIntentGraph
+func (c *Client) IntentGraph(ctx context.Context, audio Audio) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	res := Result{RPC: "intent_graph", Session: vars.GenerateID()}
+	start := time.Now()
+	stream, err := c.chipper.StreamingIntentGraph(ctx)
+	if err != nil {
+		return res, err
+	}
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- c.play(ctx, audio, func(chunk []byte) error {
+			return stream.Send(&pb.StreamingIntentGraphRequest{
+				Session:       res.Session,
+				DeviceId:      c.cfg.DeviceID,
+				InputAudio:    chunk,
+				LanguageCode:  c.cfg.Language,
+				Mode:          c.cfg.Mode,
+				AudioEncoding: audio.Encoding,
+			})
+		}, stream.CloseSend)
+	}()
+	resp, err := stream.Recv()
+	res.Duration = time.Since(start)
+	cancel()
+	if err != nil {
+		return res, c.streamError(err, sendErr)
+	}
+	resultFromIntent(resp.IntentResult, &res)
+	res.SpokenText = resp.SpokenText
+	res.CommandType = resp.CommandType
+	if resp.QueryText != "" {
+		res.QueryText = resp.QueryText
+	}
+	return res, nil
+}
+
+// Intent streams audio to StreamingIntent, what robots on older firmware use
+func (c *Client) Intent(ctx context.Context, audio Audio) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	res := Result{RPC: "intent", Session: vars.GenerateID()}
+	start := time.Now()
+	stream, err := c.chipper.StreamingIntent(ctx)
+	if err != nil {
+		return res, err
+	}
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- c.play(ctx, audio, func(chunk []byte) error {
+			return stream.Send(&pb.StreamingIntentRequest{
+				Session:       res.Session,
+				DeviceId:      c.cfg.DeviceID,
+				InputAudio:    chunk,
+				LanguageCode:  c.cfg.Language,
+				Mode:          c.cfg.Mode,
+				AudioEncoding: audio.Encoding,
+			})
+		}, stream.CloseSend)
+	}()
+	resp, err := stream.Recv()
+	res.Duration = time.Since(start)
+	cancel()
+	if err != nil {
+		return res, c.streamError(err, sendErr)
+	}
+	resultFromIntent(resp.IntentResult, &res)
+	return res, nil
+}
+
+// KnowledgeGraph streams audio to StreamingKnowledgeGraph
+func (c *Client) KnowledgeGraph(ctx context.Context, audio Audio) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	res := Result{RPC: "knowledge_graph", Session: vars.GenerateID()}
+	start := time.Now()
+	stream, err := c.chipper.StreamingKnowledgeGraph(ctx)
+	if err != nil {
+		return res, err
+	}
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- c.play(ctx, audio, func(chunk []byte) error {
+			return stream.Send(&pb.StreamingKnowledgeGraphRequest{
+				Session:       res.Session,
+				DeviceId:      c.cfg.DeviceID,
+				InputAudio:    chunk,
+				LanguageCode:  c.cfg.Language,
+				AudioEncoding: audio.Encoding,
+			})
+		}, stream.CloseSend)
+	}()
+	resp, err := stream.Recv()
+	res.Duration = time.Since(start)
+	cancel()
+	if err != nil {
+		return res, c.streamError(err, sendErr)
+	}
+	res.QueryText = resp.QueryText
+	res.SpokenText = resp.SpokenText
+	res.CommandType = resp.CommandType
+	return res, nil
+}
+
+// Send streams audio to the named RPC: "intent_graph", "intent" or "knowledge_graph"
+func (c *Client) Send(ctx context.Context, rpc string, audio Audio) (Result, error) {
+	switch rpc {
+	case "", "intent_graph":
+		return c.IntentGraph(ctx, audio)
+	case "intent":
+		return c.Intent(ctx, audio)
+	case "knowledge_graph":
+		return c.KnowledgeGraph(ctx, audio)
+	}
+	return Result{}, errors.New("unknown rpc " + rpc)
+}
+
+// prefers the sender's error, which says more than the Recv that followed it
+func (c *Client) streamError(recvErr error, sendErr chan error) error {
+	select {
+	case err := <-sendErr:
+		if err != nil {
+			return errors.New("sending audio: " + err.Error())
+		}
+	default:
+	}
+	return recvErr
+}
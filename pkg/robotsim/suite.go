@@ -0,0 +1,207 @@
+package robotsim
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+// a fixture directory holds audio files (.wav, .pcm, .ogg), each with an optional sidecar
+// <name>.json saying what chipper should answer:
+//   {"rpc": "intent_graph", "language": "en-US", "mode": "VOICE_COMMAND",
+//    "intent": "intent_weather_extend", "params": {"condition": "weather"},
+//    "transcript": "what's the weather", "spoken_contains": "degrees"}
+// a metadata.jsonl from cmd/recexport works too, every line becomes a fixture.
+// fixtures without a sidecar are played and their result printed, nothing is checked.
+
+// Expect is what a fixture should get back. Empty fields aren't checked.
+type Expect struct {
+	RPC      string `json:"rpc"`
+	Language string `json:"language"`
+	Mode     string `json:"mode"`
+
+	Intent string `json:"intent"`
+	// only the listed params are compared
+	Params         map[string]string `json:"params"`
+	Transcript     string            `json:"transcript"`
+	SpokenContains string            `json:"spoken_contains"`
+}
+
+type Fixture struct {
+	Name   string
+	Audio  string
+	Expect *Expect
+}
+
+var audioExts = map[string]bool{".wav": true, ".pcm": true, ".raw": true, ".ogg": true, ".opus": true}
+
+// Check returns why res doesn't match, or nil
+func (e Expect) Check(res Result) error {
+	var problems []string
+	if e.Intent != "" && res.Intent != e.Intent {
+		problems = append(problems, fmt.Sprintf("intent %q, want %q", res.Intent, e.Intent))
+	}
+	var keys []string
+	for k := range e.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if got, ok := res.Params[k]; !ok || got != e.Params[k] {
+			problems = append(problems, fmt.Sprintf("param %s=%q, want %q", k, got, e.Params[k]))
+		}
+	}
+	if e.Transcript != "" && !strings.EqualFold(strings.TrimSpace(res.QueryText), strings.TrimSpace(e.Transcript)) {
+		problems = append(problems, fmt.Sprintf("transcript %q, want %q", res.QueryText, e.Transcript))
+	}
+	if e.SpokenContains != "" && !strings.Contains(strings.ToLower(res.SpokenText), strings.ToLower(e.SpokenContains)) {
+		problems = append(problems, fmt.Sprintf("spoken text %q doesn't contain %q", res.SpokenText, e.SpokenContains))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// LoadFixtures finds the fixtures in dir
+func LoadFixtures(dir string) ([]Fixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.New("LoadFixtures: " + err.Error())
+	}
+	var fixtures []Fixture
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if e.Name() == "metadata.jsonl" {
+			fromMeta, err := loadMetadataFixtures(dir, filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			fixtures = append(fixtures, fromMeta...)
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !audioExts[ext] {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		f := Fixture{Name: name, Audio: filepath.Join(dir, e.Name())}
+		sidecar, err := os.ReadFile(filepath.Join(dir, name+".json"))
+		if err == nil {
+			var expect Expect
+			if err := json.Unmarshal(sidecar, &expect); err != nil {
+				return nil, errors.New("LoadFixtures: " + name + ".json: " + err.Error())
+			}
+			f.Expect = &expect
+		} else if !os.IsNotExist(err) {
+			return nil, errors.New("LoadFixtures: " + err.Error())
+		}
+		fixtures = append(fixtures, f)
+	}
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].Name < fixtures[j].Name })
+	return fixtures, nil
+}
+
+func loadMetadataFixtures(dir string, path string) ([]Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("LoadFixtures: " + err.Error())
+	}
+	defer file.Close()
+	var fixtures []Fixture
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry struct {
+			Audio    string            `json:"audio"`
+			Intent   string            `json:"intent"`
+			Params   map[string]string `json:"params"`
+			Language string            `json:"language"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Audio == "" {
+			continue
+		}
+		fixtures = append(fixtures, Fixture{
+			Name:  strings.TrimSuffix(filepath.Base(entry.Audio), filepath.Ext(entry.Audio)),
+			Audio: filepath.Join(dir, entry.Audio),
+			Expect: &Expect{
+				Intent:   entry.Intent,
+				Params:   entry.Params,
+				Language: entry.Language,
+			},
+		})
+	}
+	return fixtures, scanner.Err()
+}
+
+// Run plays one fixture, over rpc unless the fixture names its own. The error is set if it
+// couldn't be played or didn't match.
+func (c *Client) Run(ctx context.Context, f Fixture, rpc string, chunkMs int, padMs int) (Result, error) {
+	audio, err := LoadAudio(f.Audio, chunkMs, padMs)
+	if err != nil {
+		return Result{}, err
+	}
+	run := c
+	if f.Expect != nil {
+		if f.Expect.RPC != "" {
+			rpc = f.Expect.RPC
+		}
+		clientCopy := *c
+		if f.Expect.Language != "" {
+			clientCopy.cfg.Language = LanguageCode(f.Expect.Language)
+		}
+		if f.Expect.Mode != "" {
+			mode, ok := pb.RobotMode_value[strings.ToUpper(f.Expect.Mode)]
+			if !ok {
+				return Result{}, errors.New("unknown mode " + f.Expect.Mode)
+			}
+			clientCopy.cfg.Mode = pb.RobotMode(mode)
+		}
+		run = &clientCopy
+	}
+	res, err := run.Send(ctx, rpc, audio)
+	if err != nil {
+		return res, err
+	}
+	if f.Expect != nil {
+		return res, f.Expect.Check(res)
+	}
+	return res, nil
+}
+
+// RunSuite plays every fixture in dir, writing a line per fixture to out. rpc is used for the
+// fixtures that don't name one
+func (c *Client) RunSuite(ctx context.Context, dir string, rpc string, chunkMs int, padMs int, out io.Writer) (passed int, failed int, err error) {
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fixtures) == 0 {
+		return 0, 0, errors.New("no fixtures in " + dir)
+	}
+	for _, f := range fixtures {
+		res, err := c.Run(ctx, f, rpc, chunkMs, padMs)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %s\n", f.Name, err)
+			continue
+		}
+		passed++
+		status := "PASS"
+		if f.Expect == nil {
+			status = "RAN "
+		}
+		fmt.Fprintf(out, "%s %s: %s %v %q (%s)\n", status, f.Name, res.Intent, res.Params, res.QueryText, res.Duration.Round(1e6))
+	}
+	return passed, failed, nil
+}
@@ -1,15 +1,19 @@
 package accounts
 
 import (
+	"cavalier/pkg/metrics"
+	"cavalier/pkg/recording"
 	"cavalier/pkg/sessions"
 	"cavalier/pkg/users"
 	"cavalier/pkg/vars"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -69,9 +73,6 @@ func corsMiddleware(next http.Handler) http.Handler {
 func AccountsAPI(w http.ResponseWriter, r *http.Request) {
 	fmt.Println(r.URL.Path)
 	switch r.URL.Path {
-	// case "/ok":
-	// 	w.WriteHeader(http.StatusOK)
-	// 	return
 	case "/v1/sessions":
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -85,7 +86,12 @@ func AccountsAPI(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		var user vars.UserInDB
-		if creds.Username == "" {
+		household, lanMode := users.Household()
+		if creds.Username == "" && lanMode {
+			metrics.Logins.WithLabelValues("household").Inc()
+			user = household
+		} else if creds.Username == "" {
+			metrics.Logins.WithLabelValues("anonymous").Inc()
 			user = vars.UserInDB{
 				Email:  "blank@example.com",
 				UUID:   "notauser",
@@ -95,6 +101,11 @@ func AccountsAPI(w http.ResponseWriter, r *http.Request) {
 			}
 		} else {
 			user, err = users.AuthUser(creds.Username, creds.Password)
+			if err != nil {
+				metrics.Logins.WithLabelValues("failure").Inc()
+			} else {
+				metrics.Logins.WithLabelValues("success").Inc()
+			}
 		}
 		if err != nil {
 			vars.HTTPError(w, err.Error(), err.Error(), http.StatusForbidden)
@@ -142,6 +153,21 @@ func AccountsAPI(w http.ResponseWriter, r *http.Request) {
 		vars.HTTPSuccess(w, "account created")
 	}
 
+	if r.URL.Path == "/v1/recording" {
+		recordingOptIn(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/v1/server_config/") {
+		serverConfig(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/v1/connection_checks/") {
+		connectionChecks(w, r)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/v1/session_cert/") {
 		urlSplit := strings.Split(r.URL.Path, "/")
 		if len(urlSplit) == 4 {
@@ -157,6 +183,128 @@ func AccountsAPI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// the user ID of the session in the Authorization header. writes the error and returns false if there isn't a good one
+func sessionUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || !sessions.IsSessionGood(token) {
+		vars.HTTPError(w, vars.CodeSessionExpired, "invalid or expired session", http.StatusUnauthorized)
+		return "", false
+	}
+	return sessions.GetUserIDFromSession(token), true
+}
+
+type recordingOptInRequest struct {
+	// empty for the whole account
+	ESN     string `json:"esn"`
+	Enabled bool   `json:"enabled"`
+}
+
+// opt in to (or out of) recording voice requests, for one robot or every robot on the account
+//
+//	GET /v1/recording
+//	PUT /v1/recording {"esn": "00e20100", "enabled": true}
+//	Authorization: Bearer <session token>
+func recordingOptIn(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	if userID == "notauser" {
+		// the blank account can see every robot, it can't turn on recording for them
+		vars.HTTPError(w, vars.CodeBadCredentials, "log in to a real account to change recording", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var optIn recordingOptInRequest
+		if err := json.NewDecoder(r.Body).Decode(&optIn); err != nil {
+			vars.HTTPError(w, "failed to unmarshal json: "+err.Error(), vars.CodeServerError, http.StatusBadRequest)
+			return
+		}
+		kind, id := recording.KindAccount, userID
+		if optIn.ESN != "" {
+			kind, id = recording.KindRobot, vars.Thingifier(optIn.ESN)
+			if !users.IsRobotAssociatedWithAccount(id, userID) {
+				vars.HTTPError(w, "not_found", "robot not found", http.StatusNotFound)
+				return
+			}
+		}
+		if err := recording.SetOptIn(kind, id, optIn.Enabled); err != nil {
+			vars.HTTPError(w, err.Error(), vars.CodeServerError, 500)
+			return
+		}
+		slog.Info("recording opt-in changed", "kind", kind, "id", id, "enabled", optIn.Enabled)
+	default:
+		vars.HTTPError(w, "method_not_allowed", "use GET or PUT", http.StatusMethodNotAllowed)
+		return
+	}
+	things, err := users.GetESNsForUser(userID)
+	if err != nil {
+		vars.HTTPError(w, err.Error(), vars.CodeServerError, 500)
+		return
+	}
+	robots := make(map[string]bool)
+	for _, thing := range things {
+		robots[strings.TrimPrefix(thing, "vic:")] = recording.IsOptedIn(recording.KindRobot, thing)
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"account": recording.IsOptedIn(recording.KindAccount, userID),
+		"robots":  robots,
+	})
+	if err != nil {
+		vars.HTTPError(w, "failed to marshal json: "+err.Error(), vars.CodeServerError, 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// connection check history for one of the caller's robots
+//
+//	GET /v1/connection_checks/<esn>?limit=20
+//	Authorization: Bearer <session token>
+func connectionChecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		vars.HTTPError(w, "method_not_allowed", "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	esn := strings.TrimPrefix(r.URL.Path, "/v1/connection_checks/")
+	if esn == "" || strings.Contains(esn, "/") {
+		vars.HTTPError(w, "not_found", "no robot given", http.StatusNotFound)
+		return
+	}
+	thing := vars.Thingifier(esn)
+	if !users.IsRobotAssociatedWithAccount(thing, userID) {
+		// same answer as a robot we've never seen, so this can't be used to find ESNs
+		vars.HTTPError(w, "not_found", "robot not found", http.StatusNotFound)
+		return
+	}
+	limit := vars.ConnectionCheckHistoryLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+	checks, err := vars.GetConnectionChecks(thing, limit)
+	if err != nil {
+		vars.HTTPError(w, err.Error(), vars.CodeServerError, 500)
+		return
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"esn":               strings.TrimPrefix(thing, "vic:"),
+		"connection_checks": checks,
+	})
+	if err != nil {
+		vars.HTTPError(w, "failed to marshal json: "+err.Error(), vars.CodeServerError, 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
 func main() {
 	handler := maxRequestSizeMiddleware(rateLimitMiddleware(corsMiddleware(http.HandlerFunc(AccountsAPI))))
 	http.Handle("/v1/", handler)
@@ -0,0 +1,181 @@
+package accounts
+
+import (
+	"cavalier/pkg/users"
+	"cavalier/pkg/vars"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ServerCert is the certificate being served, set at startup. the CA in server config bundles
+// comes from its chain when there's no server.ca
+var ServerCert func() *tls.Certificate
+
+// the server_config.json robot firmware reads. logfiles and appkey are what Anki shipped,
+// robots send them along but nothing here checks them
+type robotServerConfig struct {
+	Jdocs    string `json:"jdocs"`
+	Token    string `json:"tms"`
+	Chipper  string `json:"chipper"`
+	Check    string `json:"check"`
+	Logfiles string `json:"logfiles"`
+	Appkey   string `json:"appkey"`
+}
+
+type serverConfigBundle struct {
+	ESN          string            `json:"esn"`
+	ServerConfig robotServerConfig `json:"server_config"`
+	AccountsURL  string            `json:"accounts_url"`
+	CACert       string            `json:"ca_cert"`
+}
+
+// the name robots reach us on: server.public_host, escapepod.local (or whatever lan.hostname says)
+// in LAN mode, or else the first name on the certificate that isn't localhost or a wildcard
+func publicHost() (string, error) {
+	if vars.PublicHost != "" {
+		return vars.PublicHost, nil
+	}
+	if c := vars.Config(); c.Server.EPConfig {
+		return c.LAN.Hostname + ".local", nil
+	}
+	if ServerCert != nil {
+		if cert := ServerCert(); cert != nil && cert.Leaf != nil {
+			for _, name := range cert.Leaf.DNSNames {
+				if name != "localhost" && !strings.HasPrefix(name, "*") {
+					return name, nil
+				}
+			}
+		}
+	}
+	return "", errors.New("set server.public_host (" + vars.PublicHostEnv + ") to the name robots reach cavalier on")
+}
+
+// host with the port of addr, left off if it's the scheme's default
+func hostPort(host, addr, defaultPort string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	if port == defaultPort || port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// server.ca, or the last certificate in the served chain, which is the CA if the chain
+// includes it and the certificate itself if it's self-signed
+func caPEM() ([]byte, error) {
+	if vars.CAPath != "" {
+		return os.ReadFile(vars.CAPath)
+	}
+	if ServerCert == nil || ServerCert() == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	chain := ServerCert().Certificate
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[len(chain)-1]}), nil
+}
+
+func buildServerConfigBundle(esn string) (serverConfigBundle, error) {
+	host, err := publicHost()
+	if err != nil {
+		return serverConfigBundle{}, err
+	}
+	ca, err := caPEM()
+	if err != nil {
+		return serverConfigBundle{}, errors.New("failed to read the CA certificate: " + err.Error())
+	}
+	// chipper, token and jdocs share the gRPC listener. the firmware always wants a port there
+	_, grpcPort, _ := net.SplitHostPort(vars.ChipperAddr)
+	grpcURL := net.JoinHostPort(host, grpcPort)
+	// the connection check is plain HTTP when there is a plain listener
+	checkAddr, checkDefault := vars.AccountsAddr, "80"
+	accountsURL := "http://" + hostPort(host, vars.AccountsAddr, "80")
+	if vars.AccountsTLSAddr != "" {
+		accountsURL = "https://" + hostPort(host, vars.AccountsTLSAddr, "443")
+	}
+	if checkAddr == "" {
+		checkAddr, checkDefault = vars.AccountsTLSAddr, "443"
+	}
+	return serverConfigBundle{
+		ESN: esn,
+		ServerConfig: robotServerConfig{
+			Jdocs:    grpcURL,
+			Token:    grpcURL,
+			Chipper:  grpcURL,
+			Check:    hostPort(host, checkAddr, checkDefault) + "/ok",
+			Logfiles: "s3://anki-device-logs-prod/victor",
+			Appkey:   "oDoa0quieSeir6goowai7f",
+		},
+		AccountsURL: accountsURL,
+		CACert:      string(ca),
+	}, nil
+}
+
+// everything a robot needs to be pointed at this server, from the running config
+//
+//	GET /v1/server_config/<esn>                          the bundle as JSON
+//	GET /v1/server_config/<esn>?file=server_config.json  just the firmware's server config
+//	GET /v1/server_config/<esn>?file=ca.crt              just the CA
+//	Authorization: Bearer <session token>
+//
+// a robot that isn't on any account yet can be asked for, so it can be set up. one that's
+// on someone else's account is not found
+func serverConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		vars.HTTPError(w, "method_not_allowed", "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	esn := strings.TrimPrefix(r.URL.Path, "/v1/server_config/")
+	if esn == "" || strings.Contains(esn, "/") {
+		vars.HTTPError(w, "not_found", "no robot given", http.StatusNotFound)
+		return
+	}
+	thing := vars.Thingifier(esn)
+	owners, err := users.GetUsersForRobot(thing)
+	if err != nil {
+		vars.HTTPError(w, err.Error(), vars.CodeServerError, 500)
+		return
+	}
+	if len(owners) > 0 && !users.IsRobotAssociatedWithAccount(thing, userID) {
+		vars.HTTPError(w, "not_found", "robot not found", http.StatusNotFound)
+		return
+	}
+	bundle, err := buildServerConfigBundle(strings.TrimPrefix(thing, "vic:"))
+	if err != nil {
+		vars.HTTPError(w, "server_config_unavailable", err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	switch file := r.URL.Query().Get("file"); file {
+	case "":
+		out, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			vars.HTTPError(w, "failed to marshal json: "+err.Error(), vars.CodeServerError, 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	case "server_config.json":
+		out, err := json.Marshal(bundle.ServerConfig)
+		if err != nil {
+			vars.HTTPError(w, "failed to marshal json: "+err.Error(), vars.CodeServerError, 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="server_config.json"`)
+		w.Write(out)
+	case "ca.crt":
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="ca.crt"`)
+		w.Write([]byte(bundle.CACert))
+	default:
+		vars.HTTPError(w, "not_found", "file must be server_config.json or ca.crt", http.StatusNotFound)
+	}
+}
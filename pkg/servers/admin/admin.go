@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"cavalier/pkg/backup"
+	"cavalier/pkg/quota"
+	"cavalier/pkg/vars"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// admin endpoints, only reachable with the key from the ADMIN_KEY env var
+
+// set by cavalier so /admin/stats can show quota usage
+var Quotas *quota.Limiter
+
+func isAuthorized(r *http.Request) bool {
+	if vars.AdminKey == "" {
+		return false
+	}
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(key), []byte(vars.AdminKey)) == 1
+}
+
+// Metrics guards h with the admin key, for /metrics on the accounts listeners
+func Metrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if vars.AdminKey == "" {
+			vars.HTTPError(w, "metrics_disabled", "metrics are off, set "+vars.AdminKeyEnv+" or "+vars.MetricsAddrEnv+" to enable them", http.StatusNotFound)
+			return
+		}
+		if !isAuthorized(r) {
+			vars.HTTPError(w, vars.CodeBadCredentials, "bad admin key", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func AdminAPI(w http.ResponseWriter, r *http.Request) {
+	slog.Info("admin request", "path", r.URL.Path)
+	if vars.AdminKey == "" {
+		vars.HTTPError(w, "admin_disabled", "admin API is disabled, set "+vars.AdminKeyEnv+" to enable it", http.StatusNotFound)
+		return
+	}
+	if !isAuthorized(r) {
+		vars.HTTPError(w, vars.CodeBadCredentials, "bad admin key", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/admin/backup":
+		if r.Method != http.MethodPost {
+			vars.HTTPError(w, "method_not_allowed", "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+backup.DefaultArchiveName()+"\"")
+		if err := backup.WriteArchive(w); err != nil {
+			// headers are likely already out, so all we can do is cut the archive short and log
+			slog.Error("backup failed", "path", r.URL.Path, "error", err)
+			return
+		}
+		slog.Info("backup served", "path", r.URL.Path)
+	case "/admin/reload":
+		if r.Method != http.MethodPost {
+			vars.HTTPError(w, "method_not_allowed", "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		// a bad config is reported and the running one kept
+		result, err := vars.Reload()
+		if err != nil {
+			vars.HTTPError(w, "reload_failed", err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		out, err := json.Marshal(result)
+		if err != nil {
+			vars.HTTPError(w, vars.CodeServerError, "failed to marshal json: "+err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	case "/admin/stats":
+		stats := map[string]interface{}{
+			"robot_settings_cache": vars.GetRobotSettingsCacheStats(),
+		}
+		if Quotas != nil {
+			stats["quotas"] = Quotas.Stats()
+		}
+		out, err := json.Marshal(stats)
+		if err != nil {
+			vars.HTTPError(w, "failed to marshal json: "+err.Error(), vars.CodeServerError, 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	default:
+		vars.HTTPError(w, "not_found", "unknown admin endpoint", http.StatusNotFound)
+	}
+}
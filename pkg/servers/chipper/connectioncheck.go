@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
-	"fmt"
-	"strconv"
+	"log/slog"
+	"math"
 	"time"
 
+	"cavalier/pkg/logging"
+	"cavalier/pkg/vars"
+
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
 )
 
@@ -14,58 +17,148 @@ const (
 	check                  = "check"
 )
 
+type connCheckFrame struct {
+	req *pb.StreamingConnectionCheckRequest
+	at  time.Time
+	err error
+}
+
+// connCheckStats accumulates frame timings for one connection check
+type connCheckStats struct {
+	interval  time.Duration
+	first     time.Time
+	last      time.Time
+	bytes     int
+	deviation time.Duration
+	gaps      int
+	maxGap    time.Duration
+}
+
+func (c *connCheckStats) add(f connCheckFrame) {
+	c.bytes += len(f.req.InputAudio)
+	if c.first.IsZero() {
+		c.first = f.at
+		c.last = f.at
+		return
+	}
+	gap := f.at.Sub(c.last)
+	c.last = f.at
+	c.gaps++
+	if gap > c.maxGap {
+		c.maxGap = gap
+	}
+	diff := gap - c.interval
+	if diff < 0 {
+		diff = -diff
+	}
+	c.deviation += diff
+}
+
+func (c *connCheckStats) result(thing string, end time.Time) vars.ConnectionCheckResult {
+	res := vars.ConnectionCheckResult{
+		Thing: thing,
+		Time:  time.Now().UTC(),
+	}
+	if c.first.IsZero() {
+		return res
+	}
+	elapsed := end.Sub(c.first)
+	res.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		res.ThroughputBps = math.Round(float64(c.bytes) / elapsed.Seconds())
+	}
+	if c.gaps > 0 {
+		res.JitterMs = float64(c.deviation.Microseconds()) / float64(c.gaps) / 1000
+	}
+	res.MaxGapMs = float64(c.maxGap.Microseconds()) / 1000
+	return res
+}
+
 // StreamingConnectionCheck is used by the end device to make sure it can successfully communicate
 func (s *Server) StreamingConnectionCheck(stream pb.ChipperGrpc_StreamingConnectionCheckServer) error {
 	req, err := stream.Recv()
-	fmt.Println("Incoming connection check from " + req.DeviceId)
 	if err != nil {
-		fmt.Println("Connection check unexpected error")
-		fmt.Println(err)
+		slog.Error("connection check unexpected error", "error", err)
 		return err
 	}
+	log := logging.Request(logging.NewRequestID(), req.DeviceId)
+	log.Info("incoming connection check")
 
 	ctx, cancel := context.WithTimeout(stream.Context(), connectionCheckTimeout)
 	defer cancel()
 
-	framesPerRequest := req.TotalAudioMs / req.AudioPerRequest
+	framesPerRequest := uint32(1)
+	if req.AudioPerRequest > 0 {
+		framesPerRequest = req.TotalAudioMs / req.AudioPerRequest
+	}
+
+	stats := connCheckStats{interval: time.Duration(req.AudioPerRequest) * time.Millisecond}
+	stats.add(connCheckFrame{req: req, at: time.Now()})
+
+	// Recv blocks, so frames come in on a channel to let the timeout fire between them
+	frameChan := make(chan connCheckFrame)
+	go func() {
+		for {
+			r, err := stream.Recv()
+			select {
+			case frameChan <- connCheckFrame{req: r, at: time.Now(), err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
 
 	var toSend pb.ConnectionCheckResponse
 
 	// count frames, we already pulled the first one
 	frames := uint32(1)
 	toSend.FramesReceived = frames
+	end := time.Now()
 receiveLoop:
-	for {
+	for frames < framesPerRequest {
 		select {
 		case <-ctx.Done():
-			fmt.Println("Connection check expiration. Frames Received: " + strconv.Itoa(int(frames)))
+			log.Warn("connection check expired", "frames_received", frames)
 			toSend.Status = "Timeout"
+			end = time.Now()
 			break receiveLoop
-		default:
-			req, suberr := stream.Recv()
-
-			if suberr != nil || req == nil {
-				err = suberr
-				fmt.Println("Connection check unexpected error. Frames Received: " + strconv.Itoa(int(frames)))
-				fmt.Println(err)
-
+		case f := <-frameChan:
+			if f.err != nil || f.req == nil {
+				err = f.err
+				log.Warn("connection check unexpected error", "frames_received", frames, "error", err)
 				toSend.Status = "Error"
+				end = f.at
 				break receiveLoop
 			}
-
+			stats.add(f)
 			frames++
 			toSend.FramesReceived = frames
-			if frames >= framesPerRequest {
-				fmt.Println("Connection check success")
-				toSend.Status = "Success"
-				break receiveLoop
-			}
+			end = f.at
 		}
 	}
+	if toSend.Status == "" {
+		toSend.Status = "Success"
+	}
+
+	res := stats.result(vars.Thingifier(req.DeviceId), end)
+	res.Status = toSend.Status
+	res.FramesExpected = framesPerRequest
+	res.FramesReceived = frames
+	if err != nil {
+		res.Error = err.Error()
+	}
+	log.Info("connection check done", "status", res.Status, "frames_received", res.FramesReceived, "frames_expected", res.FramesExpected,
+		"duration_ms", res.DurationMs, "jitter_ms", res.JitterMs, "max_gap_ms", res.MaxGapMs, "throughput_bps", res.ThroughputBps)
+	if saveErr := vars.SaveConnectionCheck(res); saveErr != nil {
+		log.Error("failed to save connection check", "error", saveErr)
+	}
+
 	senderr := stream.Send(&toSend)
 	if senderr != nil {
-		fmt.Println("Failed to send connection check response to client")
-		fmt.Println(err)
+		log.Error("failed to send connection check response", "error", senderr)
 		return senderr
 	}
 	return err
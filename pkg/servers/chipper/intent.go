@@ -1,9 +1,10 @@
 package server
 
 import (
-	"fmt"
+	"log/slog"
 	"time"
 
+	"cavalier/pkg/logging"
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -15,26 +16,26 @@ func (s *Server) StreamingIntent(stream pb.ChipperGrpc_StreamingIntentServer) er
 
 	req, err := stream.Recv()
 	if err != nil {
-		fmt.Println("Intent error")
-		fmt.Println(err)
-
+		slog.Error("intent error", "error", err)
 		return err
 	}
 
+	requestID := logging.NewRequestID()
 	if _, err = s.intent.ProcessIntent(
 		&vtt.IntentRequest{
 			Time:       recvTime,
 			Stream:     stream,
 			Device:     req.DeviceId,
 			Session:    req.Session,
+			RequestID:  requestID,
+			Ctx:        stream.Context(),
 			LangString: req.LanguageCode.String(),
 			FirstReq:   req,
 			AudioCodec: req.AudioEncoding,
-			// Mode:
+			Mode:       req.Mode,
 		},
 	); err != nil {
-		fmt.Println("Intent error")
-		fmt.Println(err)
+		logging.Request(requestID, req.DeviceId).Error("intent error", "error", err)
 		return err
 	}
 
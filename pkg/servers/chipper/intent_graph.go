@@ -1,9 +1,10 @@
 package server
 
 import (
-	"fmt"
+	"log/slog"
 	"time"
 
+	"cavalier/pkg/logging"
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -15,26 +16,26 @@ func (s *Server) StreamingIntentGraph(stream pb.ChipperGrpc_StreamingIntentGraph
 
 	req, err := stream.Recv()
 	if err != nil {
-		fmt.Println("Intent graph stream error")
-		fmt.Println(err)
-
+		slog.Error("intent graph stream error", "error", err)
 		return err
 	}
 
+	requestID := logging.NewRequestID()
 	if _, err = s.intentGraph.ProcessIntentGraph(
 		&vtt.IntentGraphRequest{
 			Time:       recvTime,
 			Stream:     stream,
 			Device:     req.DeviceId,
 			Session:    req.Session,
+			RequestID:  requestID,
+			Ctx:        stream.Context(),
 			LangString: req.LanguageCode.String(),
 			FirstReq:   req,
 			AudioCodec: req.AudioEncoding,
-			// Mode:
+			Mode:       req.Mode,
 		},
 	); err != nil {
-		fmt.Println("Intent graph processing error")
-		fmt.Println(err)
+		logging.Request(requestID, req.DeviceId).Error("intent graph processing error", "error", err)
 		return err
 	}
 
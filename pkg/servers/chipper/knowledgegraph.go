@@ -1,9 +1,10 @@
 package server
 
 import (
-	"fmt"
+	"log/slog"
 	"time"
 
+	"cavalier/pkg/logging"
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -14,27 +15,27 @@ func (s *Server) StreamingKnowledgeGraph(stream pb.ChipperGrpc_StreamingKnowledg
 	recvTime := time.Now()
 	req, err := stream.Recv()
 	if err != nil {
-		fmt.Println("Knowledge graph error")
-		fmt.Println(err)
-
+		slog.Error("knowledge graph error", "error", err)
 		return err
 	}
 
+	requestID := logging.NewRequestID()
 	if _, err = s.kg.ProcessKnowledgeGraph(
 		&vtt.KnowledgeGraphRequest{
 			Time:       recvTime,
 			Stream:     stream,
 			Device:     req.DeviceId,
 			Session:    req.Session,
+			RequestID:  requestID,
+			Ctx:        stream.Context(),
 			LangString: req.LanguageCode.String(),
 			FirstReq:   req,
 			AudioCodec: req.AudioEncoding,
-			// Why is this not passed
-			// Mode:
+			// StreamingKnowledgeGraphRequest has no mode field, knowledge graph requests are always voice commands
+			Mode: pb.RobotMode_VOICE_COMMAND,
 		},
 	); err != nil {
-		fmt.Println("Knowledge graph error")
-		fmt.Println(err)
+		logging.Request(requestID, req.DeviceId).Error("knowledge graph error", "error", err)
 		return err
 	}
 
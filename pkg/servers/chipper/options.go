@@ -7,6 +7,7 @@ type options struct {
 	intent      intentProcessor
 	kg          kgProcessor
 	intentGraph intentGraphProcessor
+	textIntent  textIntentProcessor
 }
 
 // Option is the list of options
@@ -39,3 +40,10 @@ func WithIntentGraphProcessor(s intentGraphProcessor) Option {
 		o.intentGraph = s
 	}
 }
+
+// WithTextIntentProcessor sets the text intent processor
+func WithTextIntentProcessor(s textIntentProcessor) Option {
+	return func(o *options) {
+		o.textIntent = s
+	}
+}
@@ -18,11 +18,16 @@ type intentGraphProcessor interface {
 	ProcessIntentGraph(*vtt.IntentGraphRequest) (*vtt.IntentGraphResponse, error)
 }
 
+type textIntentProcessor interface {
+	ProcessTextIntent(*vtt.TextIntentRequest) (*vtt.IntentResponse, error)
+}
+
 // Server defines the service used.
 type Server struct {
 	intent      intentProcessor
 	kg          kgProcessor
 	intentGraph intentGraphProcessor
+	textIntent  textIntentProcessor
 
 	pb.UnimplementedChipperGrpcServer
 }
@@ -41,6 +46,7 @@ func New(opts ...Option) (*Server, error) {
 		intent:      cfg.intent,
 		kg:          cfg.kg,
 		intentGraph: cfg.intentGraph,
+		textIntent:  cfg.textIntent,
 	}
 
 	return &s, nil
@@ -2,6 +2,11 @@ package server
 
 import (
 	"context"
+	"time"
+
+	"cavalier/pkg/logging"
+	"cavalier/pkg/vars"
+	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
 	"google.golang.org/grpc/codes"
@@ -10,5 +15,37 @@ import (
 
 // TextIntent handles text-based request/responses from the device
 func (s *Server) TextIntent(ctx context.Context, req *pb.TextRequest) (*pb.IntentResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "")
+	if s.textIntent == nil {
+		return nil, status.Errorf(codes.Unimplemented, "")
+	}
+	if req.TextInput == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "text_input is required")
+	}
+
+	requestID := logging.NewRequestID()
+	resp, err := s.textIntent.ProcessTextIntent(
+		&vtt.TextIntentRequest{
+			Time:       time.Now(),
+			Device:     req.DeviceId,
+			Session:    req.Session,
+			RequestID:  requestID,
+			Ctx:        ctx,
+			LangString: req.LanguageCode.String(),
+			Text:       req.TextInput,
+			FirstReq:   req,
+			Mode:       req.Mode,
+		},
+	)
+	if err != nil {
+		logging.Request(requestID, req.DeviceId).Error("text intent error", "error", err)
+		if err == vars.ErrDeviceBlacklisted {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if resp == nil || resp.Intent == nil {
+		return nil, status.Errorf(codes.Internal, "no intent was produced")
+	}
+
+	return resp.Intent, nil
 }
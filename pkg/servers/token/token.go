@@ -59,7 +59,10 @@ func getBotDetailsFromTokReq(ctx context.Context, req *tokenpb.AssociatePrimaryU
 	if !ok {
 		return "", nil, "", "", errors.New("no metadata found in context")
 	}
-	token = md["anki-user-session"][0]
+	// robots set up in LAN mode may not send one
+	if session := md["anki-user-session"]; len(session) > 0 {
+		token = session[0]
+	}
 	fmt.Println(token, cert, name, esn)
 	return token, cert, name, esn, nil
 }
@@ -143,12 +146,18 @@ func (s *TokenServer) AssociatePrimaryUser(ctx context.Context, req *tokenpb.Ass
 	if err != nil {
 		return nil, err
 	}
+	userID := sessions.GetUserIDFromSession(token)
 	if !sessions.IsSessionGood(token) {
-		return nil, errors.New("session_expired")
+		// in LAN mode the robot may have been set up without logging in here, it goes on the household
+		household, ok := users.Household()
+		if !ok {
+			return nil, errors.New("session_expired")
+		}
+		userID = household.UserID
 	}
 	os.WriteFile(filepath.Join(vars.SessionCertsStorage, name+"_"+esn), cert, 0777)
-	bundle := GenJWT(sessions.GetUserIDFromSession(token), thing)
-	users.AssociateRobotWithAccount(thing, sessions.GetUserIDFromSession(token))
+	bundle := GenJWT(userID, thing)
+	users.AssociateRobotWithAccount(thing, userID)
 	return &tokenpb.AssociatePrimaryUserResponse{Data: bundle}, nil
 }
 
@@ -0,0 +1,44 @@
+package shutdown
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// things to release once the servers have stopped taking requests, like STT engines.
+// hooks run in reverse order of registration, like defers.
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+var (
+	mu    sync.Mutex
+	hooks []hook
+)
+
+// Register adds a hook for Run. fn should give up when ctx is done.
+func Register(name string, fn func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook{name: name, fn: fn})
+}
+
+// Run runs the hooks, last registered first. failures are logged and don't stop the rest.
+func Run(ctx context.Context) {
+	mu.Lock()
+	toRun := hooks
+	hooks = nil
+	mu.Unlock()
+	for i := len(toRun) - 1; i >= 0; i-- {
+		start := time.Now()
+		if err := toRun[i].fn(ctx); err != nil {
+			slog.Error("shutdown step failed", "step", toRun[i].name, "error", err)
+			continue
+		}
+		slog.Debug("shutdown step done", "step", toRun[i].name, "duration", time.Since(start))
+	}
+}
@@ -2,13 +2,19 @@ package speechrequest
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
-	"fmt"
+	"io"
+	"log/slog"
 	"math"
 	"os"
+	"sync"
 	"time"
 
+	"cavalier/pkg/health"
+	"cavalier/pkg/logging"
+	"cavalier/pkg/vars"
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -20,13 +26,12 @@ import (
 // one type and many functions for dealing with intent, intent-graph, and knowledge-graph requests
 // also some functions to help decode the stream bytes into ones friendly for stt engines
 
-var debugWriteFile bool = false
-var debugFile *os.File
 var sileroModel *vad.Model
 
 type SpeechRequest struct {
 	Device         string
 	Session        string
+	RequestID      string
 	FirstReq       []byte
 	Stream         interface{}
 	IsKG           bool
@@ -40,6 +45,70 @@ type SpeechRequest struct {
 	LastAudioChunk []byte
 	IsOpus         bool
 	OpusStream     *opus.OggStream
+	Mode           pb.RobotMode
+	// one of the loaded STT languages, like "de-DE", see localization.RequestLanguage
+	Language string
+	// the robot's stream context, cancelled when it hangs up
+	Ctx context.Context
+	// audio after this is cut off with ErrUtteranceTooLong
+	Deadline time.Time
+	// nil unless the request is being recorded
+	Capture *Capture
+}
+
+// Capture keeps a copy of a request's audio for recording. It is shared between copies of the
+// SpeechRequest, so it keeps filling while an STT engine works on its own copy.
+type Capture struct {
+	mu  sync.Mutex
+	raw []byte
+	pcm []byte
+}
+
+// StartCapture begins keeping the request's audio, including what has already been received
+func (req *SpeechRequest) StartCapture() {
+	req.Capture = &Capture{}
+	if req.IsOpus {
+		req.Capture.add(req.MicData, req.DecodedMicData)
+	} else {
+		req.Capture.add(nil, req.MicData)
+	}
+}
+
+func (c *Capture) add(raw []byte, pcm []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.raw = append(c.raw, raw...)
+	c.pcm = append(c.pcm, pcm...)
+}
+
+// Audio returns the original stream (Ogg Opus, empty for PCM streams) and the 16000 Hz PCM
+func (c *Capture) Audio() ([]byte, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.raw...), append([]byte(nil), c.pcm...)
+}
+
+var ErrUtteranceTooLong = errors.New("utterance went past the maximum length")
+var ErrStreamIdle = errors.New("no audio received before the idle timeout")
+
+// IsCutOff reports whether err means the audio was cut off by one of the stream limits
+func IsCutOff(err error) bool {
+	return errors.Is(err, ErrUtteranceTooLong) || errors.Is(err, ErrStreamIdle)
+}
+
+// Log returns a logger for this request, carrying its request ID and ESN
+func (req *SpeechRequest) Log() *slog.Logger {
+	return logging.Request(req.RequestID, req.Device)
+}
+
+func (req *SpeechRequest) Context() context.Context {
+	if req.Ctx == nil {
+		return context.Background()
+	}
+	return req.Ctx
 }
 
 func BytesToSamples(buf []byte) []int16 {
@@ -54,11 +123,11 @@ func (req *SpeechRequest) OpusDetect() bool {
 	var isOpus bool
 	if len(req.FirstReq) > 0 {
 		if req.FirstReq[0] == 0x4f {
-			fmt.Println("Bot " + req.Device + " Stream type: OPUS")
+			req.Log().Debug("stream type", "type", "opus")
 			isOpus = true
 		} else {
 			isOpus = false
-			fmt.Println("Bot " + req.Device + " Stream type: PCM")
+			req.Log().Debug("stream type", "type", "pcm")
 		}
 	}
 	return isOpus
@@ -68,7 +137,7 @@ func (req *SpeechRequest) OpusDecode(chunk []byte) []byte {
 	if req.IsOpus {
 		n, err := req.OpusStream.Decode(chunk)
 		if err != nil {
-			fmt.Println(err)
+			req.Log().Warn("opus decode failed", "error", err)
 		}
 		return n
 	} else {
@@ -94,7 +163,7 @@ func BytesToIntVAD(stream opus.OggStream, data []byte, die bool, isOpus bool) []
 		// opus
 		n, err := stream.Decode(data)
 		if err != nil {
-			fmt.Println(err)
+			slog.Warn("opus decode failed", "error", err)
 		}
 		byteArray := SplitVAD(n)
 		return byteArray
@@ -108,15 +177,21 @@ func BytesToIntVAD(stream opus.OggStream, data []byte, die bool, isOpus bool) []
 func init() {
 	err := onnx.Init("./silero/libonnxruntime.so")
 	if err != nil {
-		println("couldn't load onnx:", err)
+		slog.Error("couldn't load onnx", "error", err)
 		os.Exit(1)
 	}
 	sileroModel, err = vad.NewModel(16000, "./silero/silero_vad.onnx")
 	if err != nil {
-		println("couldn't load vad model:", err)
+		slog.Error("couldn't load vad model", "error", err)
 		os.Exit(1)
 	}
-	println("loaded vad")
+	slog.Info("loaded vad")
+	health.Register("silero_vad", func(ctx context.Context) error {
+		if sileroModel == nil {
+			return errors.New("vad model not loaded")
+		}
+		return nil
+	})
 }
 
 func byteToFloat32(b []byte) []float32 {
@@ -131,18 +206,19 @@ func byteToFloat32(b []byte) []float32 {
 func (req *SpeechRequest) DetectEndOfSpeech() (bool, bool) {
 	if req.SileroVADInst == nil {
 		var err error
+		vadConfig := vars.Config().VAD
 		req.SileroVADInst, err = vad.NewDetector(sileroModel, vad.Config{
-			SpeechThreshold: 0.5,
-			MinSilence:      100 * time.Millisecond,
-			SpeechPad:       30 * time.Millisecond,
+			SpeechThreshold: float32(vadConfig.SpeechThreshold),
+			MinSilence:      time.Duration(vadConfig.MinSilence) * time.Millisecond,
+			SpeechPad:       time.Duration(vadConfig.SpeechPad) * time.Millisecond,
 		}, func(start, end vad.SampleOffset) {
 			if end != -1 {
-				println("Bot " + req.Device + " End of speech detected.")
+				req.Log().Debug("end of speech detected")
 				req.SileroDone = true
 			}
 		})
 		if err != nil {
-			println("failed to make vad detector: ", err)
+			req.Log().Error("failed to make vad detector", "error", err)
 			os.Exit(1)
 		}
 	}
@@ -194,24 +270,28 @@ func applyGain(samples []int16, gain float64) []int16 {
 
 // Converts a vtt.*Request to a SpeechRequest, which allows functions like DetectEndOfSpeech to work
 func ReqToSpeechRequest(req interface{}) SpeechRequest {
-	if debugWriteFile {
-		debugFile, _ = os.Create("/tmp/wirepodtest.ogg")
-	}
 	var request SpeechRequest
 	request.PrevLen = 0
+	request.Deadline = time.Now().Add(vars.MaxUtteranceLength)
 	if str, ok := req.(*vtt.IntentRequest); ok {
 		var req1 *vtt.IntentRequest = str
 		request.Device = req1.Device
 		request.Session = req1.Session
+		request.RequestID = req1.RequestID
 		request.Stream = req1.Stream
+		request.Ctx = req1.Ctx
 		request.FirstReq = req1.FirstReq.InputAudio
+		request.Mode = req1.Mode
 		request.MicData = append(request.MicData, req1.FirstReq.InputAudio...)
 	} else if str, ok := req.(*vtt.KnowledgeGraphRequest); ok {
 		var req1 *vtt.KnowledgeGraphRequest = str
 		request.IsKG = true
 		request.Device = req1.Device
 		request.Session = req1.Session
+		request.RequestID = req1.RequestID
 		request.Stream = req1.Stream
+		request.Ctx = req1.Ctx
+		request.Mode = req1.Mode
 		request.FirstReq = req1.FirstReq.InputAudio
 		request.MicData = append(request.MicData, req1.FirstReq.InputAudio...)
 	} else if str, ok := req.(*vtt.IntentGraphRequest); ok {
@@ -219,14 +299,17 @@ func ReqToSpeechRequest(req interface{}) SpeechRequest {
 		var req1 *vtt.IntentGraphRequest = str
 		request.Device = req1.Device
 		request.Session = req1.Session
+		request.RequestID = req1.RequestID
 		request.Stream = req1.Stream
+		request.Ctx = req1.Ctx
+		request.Mode = req1.Mode
 		request.FirstReq = req1.FirstReq.InputAudio
-		if debugWriteFile {
-			debugFile.Write(req1.FirstReq.InputAudio)
-		}
 		request.MicData = append(request.MicData, req1.FirstReq.InputAudio...)
 	} else {
-		fmt.Println("reqToSpeechRequest: invalid type")
+		slog.Error("reqToSpeechRequest: invalid type")
+	}
+	if stream, ok := request.Stream.(interface{ Context() context.Context }); ok && request.Ctx == nil {
+		request.Ctx = stream.Context()
 	}
 	isOpus := request.OpusDetect()
 	if isOpus {
@@ -241,104 +324,117 @@ func ReqToSpeechRequest(req interface{}) SpeechRequest {
 	return request
 }
 
-// Returns the next chunk in the stream as 16000 Hz PCM
-func (req *SpeechRequest) GetNextStreamChunk() ([]byte, error) {
-	// returns next chunk in voice stream as pcm
+// waits for the next chunk from the robot, giving up once the stream is cancelled,
+// goes quiet for StreamIdleTimeout, or runs past the utterance deadline
+func (req *SpeechRequest) recvChunk() ([]byte, error) {
+	var recv func() ([]byte, error)
 	if str, ok := req.Stream.(pb.ChipperGrpc_StreamingIntentServer); ok {
-		var stream pb.ChipperGrpc_StreamingIntentServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
+		recv = func() ([]byte, error) {
+			chunk, err := str.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return chunk.InputAudio, nil
 		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		decodedChunk := req.OpusDecode(chunk.InputAudio)
-		req.DecodedMicData = append(req.DecodedMicData, decodedChunk...)
-		dataReturn := req.DecodedMicData[req.PrevLen:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		return dataReturn, nil
 	} else if str, ok := req.Stream.(pb.ChipperGrpc_StreamingIntentGraphServer); ok {
-		var stream pb.ChipperGrpc_StreamingIntentGraphServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
-		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		decodedChunk := req.OpusDecode(chunk.InputAudio)
-		req.DecodedMicData = append(req.DecodedMicData, decodedChunk...)
-		dataReturn := req.DecodedMicData[req.PrevLen:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		if debugWriteFile {
-			debugFile.Write(chunk.InputAudio)
+		recv = func() ([]byte, error) {
+			chunk, err := str.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return chunk.InputAudio, nil
 		}
-		return dataReturn, nil
 	} else if str, ok := req.Stream.(pb.ChipperGrpc_StreamingKnowledgeGraphServer); ok {
-		var stream pb.ChipperGrpc_StreamingKnowledgeGraphServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
+		recv = func() ([]byte, error) {
+			chunk, err := str.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return chunk.InputAudio, nil
 		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		decodedChunk := req.OpusDecode(chunk.InputAudio)
-		req.DecodedMicData = append(req.DecodedMicData, decodedChunk...)
-		dataReturn := req.DecodedMicData[req.PrevLen:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		return dataReturn, nil
+	} else {
+		req.Log().Error("recvChunk: invalid stream type")
+		return nil, errors.New("invalid type")
 	}
-	fmt.Println("invalid type")
-	return nil, errors.New("invalid type")
-}
 
-// Returns next chunk in the stream as whatever the original format is (OPUS 99% of the time)
-func (req *SpeechRequest) GetNextStreamChunkOpus() ([]byte, error) {
-	if str, ok := req.Stream.(pb.ChipperGrpc_StreamingIntentServer); ok {
-		var stream pb.ChipperGrpc_StreamingIntentServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
+	timeout := vars.StreamIdleTimeout
+	timeoutErr := ErrStreamIdle
+	if !req.Deadline.IsZero() {
+		remaining := time.Until(req.Deadline)
+		if remaining <= 0 {
+			return nil, ErrUtteranceTooLong
 		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		req.DecodedMicData = append(req.DecodedMicData, req.OpusDecode(chunk.InputAudio)...)
-		dataReturn := req.MicData[req.PrevLenRaw:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		req.PrevLenRaw = len(req.MicData)
-		return dataReturn, nil
-	} else if str, ok := req.Stream.(pb.ChipperGrpc_StreamingIntentGraphServer); ok {
-		var stream pb.ChipperGrpc_StreamingIntentGraphServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
+		if remaining < timeout {
+			timeout = remaining
+			timeoutErr = ErrUtteranceTooLong
 		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		req.DecodedMicData = append(req.DecodedMicData, req.OpusDecode(chunk.InputAudio)...)
-		dataReturn := req.MicData[req.PrevLenRaw:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		req.PrevLenRaw = len(req.MicData)
-		return dataReturn, nil
-	} else if str, ok := req.Stream.(pb.ChipperGrpc_StreamingKnowledgeGraphServer); ok {
-		var stream pb.ChipperGrpc_StreamingKnowledgeGraphServer = str
-		chunk, chunkErr := stream.Recv()
-		if chunkErr != nil {
-			fmt.Println(chunkErr)
-			return nil, chunkErr
+	}
+
+	type recvResult struct {
+		audio []byte
+		err   error
+	}
+	// buffered, so an abandoned Recv can finish once the stream closes
+	result := make(chan recvResult, 1)
+	go func() {
+		audio, err := recv()
+		result <- recvResult{audio, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-result:
+		if res.err != nil && res.err != io.EOF {
+			req.Log().Warn("stream receive failed", "error", res.err)
 		}
-		req.MicData = append(req.MicData, chunk.InputAudio...)
-		req.DecodedMicData = append(req.DecodedMicData, req.OpusDecode(chunk.InputAudio)...)
-		dataReturn := req.MicData[req.PrevLenRaw:]
-		req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
-		req.PrevLen = len(req.DecodedMicData)
-		req.PrevLenRaw = len(req.MicData)
-		return dataReturn, nil
+		return res.audio, res.err
+	case <-timer.C:
+		req.Log().Warn("audio cut off", "reason", timeoutErr.Error())
+		return nil, timeoutErr
+	case <-req.Context().Done():
+		req.Log().Info("stream cancelled", "error", req.Context().Err())
+		return nil, req.Context().Err()
+	}
+}
+
+func (req *SpeechRequest) captureChunk(chunk []byte, decodedChunk []byte) {
+	if req.IsOpus {
+		req.Capture.add(chunk, decodedChunk)
+	} else {
+		req.Capture.add(nil, chunk)
+	}
+}
+
+// Returns the next chunk in the stream as 16000 Hz PCM
+func (req *SpeechRequest) GetNextStreamChunk() ([]byte, error) {
+	// returns next chunk in voice stream as pcm
+	chunk, err := req.recvChunk()
+	if err != nil {
+		return nil, err
+	}
+	req.MicData = append(req.MicData, chunk...)
+	decodedChunk := req.OpusDecode(chunk)
+	req.DecodedMicData = append(req.DecodedMicData, decodedChunk...)
+	req.captureChunk(chunk, decodedChunk)
+	dataReturn := req.DecodedMicData[req.PrevLen:]
+	req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
+	req.PrevLen = len(req.DecodedMicData)
+	return dataReturn, nil
+}
+
+// Returns next chunk in the stream as whatever the original format is (OPUS 99% of the time)
+func (req *SpeechRequest) GetNextStreamChunkOpus() ([]byte, error) {
+	chunk, err := req.recvChunk()
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("invalid type")
-	return nil, errors.New("invalid type")
+	req.MicData = append(req.MicData, chunk...)
+	decodedChunk := req.OpusDecode(chunk)
+	req.DecodedMicData = append(req.DecodedMicData, decodedChunk...)
+	req.captureChunk(chunk, decodedChunk)
+	dataReturn := req.MicData[req.PrevLenRaw:]
+	req.LastAudioChunk = req.DecodedMicData[req.PrevLen:]
+	req.PrevLen = len(req.DecodedMicData)
+	req.PrevLenRaw = len(req.MicData)
+	return dataReturn, nil
 }
@@ -0,0 +1,128 @@
+package stt
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/vars"
+)
+
+// engines register themselves from an init func, so importing one is enough to have it. the
+// config's STT.provider picks which one is used
+
+// Engine turns a voice request into text
+type Engine interface {
+	// what STT.provider names it by
+	Name() string
+	Capabilities() Capabilities
+	// loads the engine for c. it's called again on a reload, before c is published, and should
+	// keep serving until the reloaded engine is ready
+	Init(c *vars.APIConfig) error
+	STT(req sr.SpeechRequest) (string, error)
+}
+
+// IntentEngine is an engine that goes straight from speech to an intent and its slots,
+// skipping intent matching
+type IntentEngine interface {
+	Engine
+	STI(req sr.SpeechRequest) (string, map[string]string, error)
+}
+
+type Capabilities struct {
+	// decodes while the robot is still talking, rather than once it's done
+	Streaming bool
+	// runs on this machine rather than calling out to a service
+	Local bool
+	// understands the languages in STT.language and STT.languages. the others are English only
+	Multilingual bool
+	// punctuated text with numbers as digits, like whisper's, rather than plain lowercase words
+	Formatted bool
+}
+
+func (c Capabilities) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("streaming", c.Streaming),
+		slog.Bool("local", c.Local),
+		slog.Bool("multilingual", c.Multilingual),
+		slog.Bool("formatted", c.Formatted),
+	)
+}
+
+var (
+	mu      sync.Mutex
+	engines = map[string]Engine{}
+	active  atomic.Pointer[Engine]
+)
+
+// Register adds an engine. two engines with the same name is a programming error
+func Register(e Engine) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := engines[e.Name()]; ok {
+		panic("stt.Register: " + e.Name() + " registered twice")
+	}
+	engines[e.Name()] = e
+}
+
+// Engines are the registered engines, by name
+func Engines() []Engine {
+	mu.Lock()
+	defer mu.Unlock()
+	var all []Engine
+	for _, e := range engines {
+		all = append(all, e)
+	}
+	slices.SortFunc(all, func(a, b Engine) int { return strings.Compare(a.Name(), b.Name()) })
+	return all
+}
+
+func names() []string {
+	var all []string
+	for _, e := range Engines() {
+		all = append(all, e.Name())
+	}
+	return all
+}
+
+// Use makes the engine called name the active one. an empty name picks the engine there is only
+// one of, or the local one there is only one of
+func Use(name string) (Engine, error) {
+	all := Engines()
+	if len(all) == 0 {
+		return nil, errors.New("Use: no STT engines were built in")
+	}
+	var e Engine
+	if name == "" {
+		local := slices.DeleteFunc(slices.Clone(all), func(e Engine) bool { return !e.Capabilities().Local })
+		switch {
+		case len(all) == 1:
+			e = all[0]
+		case len(local) == 1:
+			e = local[0]
+		default:
+			return nil, errors.New("Use: set STT.provider to one of " + strings.Join(names(), ", "))
+		}
+	} else {
+		mu.Lock()
+		e = engines[name]
+		mu.Unlock()
+		if e == nil {
+			return nil, errors.New("Use: unknown STT.provider " + name + ", this build has " + strings.Join(names(), ", "))
+		}
+	}
+	active.Store(&e)
+	return e, nil
+}
+
+// Active is the engine in use, nil before Use
+func Active() Engine {
+	if e := active.Load(); e != nil {
+		return *e
+	}
+	return nil
+}
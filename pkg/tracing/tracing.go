@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sets up OpenTelemetry: spans are batched to a collector over OTLP/HTTP and propagated with W3C
+// traceparent headers. spans are started with otel.Tracer("cavalier"), which does nothing until
+// Init has installed a provider
+
+var provider *sdktrace.TracerProvider
+
+// Init exports spans to the collector at endpoint ("http://localhost:4318"). ratio is the fraction
+// of new traces to keep, traces started by a caller follow its decision. with no endpoint, tracing
+// stays off
+func Init(endpoint string, serviceName string, ratio float64) error {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("tracing.Init: endpoint must be an http:// or https:// URL, got " + endpoint)
+	}
+	if serviceName == "" {
+		serviceName = "cavalier"
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(u.Path + "/v1/traces")}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return errors.New("tracing.Init: " + err.Error())
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("tracing error", "error", err)
+	}))
+	slog.Info("tracing enabled", "endpoint", endpoint, "service", serviceName, "sample_ratio", ratio)
+	return nil
+}
+
+// Shutdown exports the spans still queued and stops the exporter, or gives up when ctx is done
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// RecordError marks span as failed. nil errors are ignored
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
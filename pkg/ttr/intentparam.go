@@ -1,18 +1,31 @@
 package wirepod_ttr
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"strconv"
 	"strings"
 
+	"cavalier/pkg/tracing"
 	"cavalier/pkg/vars"
 
 	lcztn "cavalier/pkg/localization"
+
+	"go.opentelemetry.io/otel"
 )
 
+// reads the robot's settings jdoc (through the cache) under a "robot_settings" span
+func getRobotSettings(ctx context.Context, botSerial string) (vars.RobotSettings, error) {
+	_, span := otel.Tracer("cavalier").Start(ctx, "robot_settings")
+	defer span.End()
+	settings, err := vars.GetRobotSettings("vic:" + botSerial)
+	if err != vars.ErrUserNotFound {
+		tracing.RecordError(span, err)
+	}
+	return settings, err
+}
+
 // stt
-func ParamChecker(req interface{}, intent string, speechText string, botSerial string) {
+func ParamChecker(req interface{}, intent string, speechText string, botSerial string, language string) {
 	var intentParam string
 	var intentParamValue string
 	var newIntent string
@@ -22,39 +35,20 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 	var botUnits string = "F"
 	var botPlaySpecific bool = false
 	var botIsEarlyOpus bool = false
+	log := reqLog(req)
+	ctx := reqContext(req)
 
 	// see if jdoc exists
-	botJdoc, jdocExists := vars.ReadJdoc("vic:"+botSerial, "vic.RobotSettings")
-	if jdocExists == nil {
-		type robotSettingsJson struct {
-			ButtonWakeword int  `json:"button_wakeword"`
-			Clock24Hour    bool `json:"clock_24_hour"`
-			CustomEyeColor struct {
-				Enabled    bool    `json:"enabled"`
-				Hue        float64 `json:"hue"`
-				Saturation float64 `json:"saturation"`
-			} `json:"custom_eye_color"`
-			DefaultLocation  string `json:"default_location"`
-			DistIsMetric     bool   `json:"dist_is_metric"`
-			EyeColor         int    `json:"eye_color"`
-			Locale           string `json:"locale"`
-			MasterVolume     int    `json:"master_volume"`
-			TempIsFahrenheit bool   `json:"temp_is_fahrenheit"`
-			TimeZone         string `json:"time_zone"`
-		}
-		var robotSettings robotSettingsJson
-		err := json.Unmarshal([]byte(botJdoc.JsonDoc), &robotSettings)
-		if err != nil {
-			fmt.Println("Error unmarshaling json in paramchecker")
-			fmt.Println(err)
+	robotSettings, err := getRobotSettings(ctx, botSerial)
+	if err == nil {
+		botLocation = robotSettings.DefaultLocation
+		if robotSettings.TempIsFahrenheit {
+			botUnits = "F"
 		} else {
-			botLocation = robotSettings.DefaultLocation
-			if robotSettings.TempIsFahrenheit {
-				botUnits = "F"
-			} else {
-				botUnits = "C"
-			}
+			botUnits = "C"
 		}
+	} else if err != vars.ErrUserNotFound {
+		log.Error("error getting robot settings in paramchecker", "error", err)
 	}
 	if botPlaySpecific {
 		if strings.Contains(intent, "intent_play_blackjack") {
@@ -101,11 +95,11 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 			intentParams = map[string]string{intentParam: intentParamValue}
 		}
 	}
-	fmt.Println("Checking params for candidate intent " + intent)
+	log.Debug("checking params for candidate intent", "intent", intent)
 	if strings.Contains(intent, "intent_photo_take_extend") {
 		isParam = true
 		newIntent = intent
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_ME)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_SELF)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_US)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_ME, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_SELF, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_US, language)) {
 			intentParam = "entity_photo_selfie"
 			intentParamValue = "photo_selfie"
 		} else {
@@ -117,21 +111,21 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 		isParam = true
 		newIntent = "intent_imperative_eyecolor_specific_extend"
 		intentParam = "eye_color"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_PURPLE)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_PURPLE, language)) {
 			intentParamValue = "COLOR_PURPLE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_BLUE)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_SAPPHIRE)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_BLUE, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_SAPPHIRE, language)) {
 			intentParamValue = "COLOR_BLUE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_YELLOW)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_YELLOW, language)) {
 			intentParamValue = "COLOR_YELLOW"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL2)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL2, language)) {
 			intentParamValue = "COLOR_TEAL"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_GREEN)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_GREEN, language)) {
 			intentParamValue = "COLOR_GREEN"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_ORANGE)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_ORANGE, language)) {
 			intentParamValue = "COLOR_ORANGE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_RAINBOW)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_RAINBOW, language)) {
 			intentParamValue = "COLOR_RAINBOW"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_REBUILD)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_REBUILD, language)) {
 			intentParamValue = "COLOR_REBUILD"
 		} else {
 			newIntent = intent
@@ -142,7 +136,7 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 	} else if strings.Contains(intent, "intent_weather_extend") {
 		isParam = true
 		newIntent = intent
-		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser(speechText, botLocation, botUnits)
+		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser(ctx, log, speechText, botLocation, botUnits, language)
 		if local_datetime == "test" {
 			newIntent = "intent_system_unmatched"
 			isParam = false
@@ -160,22 +154,22 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 	} else if strings.Contains(intent, "intent_imperative_volumelevel_extend") {
 		isParam = true
 		newIntent = intent
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_LOW)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_LOW, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_2"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOW)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_QUIET)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOW, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_QUIET, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_1"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_HIGH)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_HIGH, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_4"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NORMAL)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_REGULAR)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NORMAL, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_REGULAR, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_3"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_HIGH)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOUD)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_HIGH, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOUD, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_5"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MUTE)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NOTHING)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_SILENT)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_OFF)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_ZERO)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MUTE, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NOTHING, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_SILENT, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_OFF, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_ZERO, language)) {
 			// there is no VOLUME_0 :(
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_0"
@@ -189,12 +183,12 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 		var nameSplitter string = ""
 		isParam = true
 		newIntent = intent
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS)
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS2)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS2)
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS3)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS3)
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS, language)
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS2, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS2, language)
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS3, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS3, language)
 		}
 		if nameSplitter != "" {
 			splitPhrase := strings.SplitAfter(speechText, nameSplitter)
@@ -206,12 +200,12 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 			} else if len(splitPhrase) > 4 {
 				username = username + " " + strings.TrimSpace(splitPhrase[2]) + " " + strings.TrimSpace(splitPhrase[3])
 			}
-			fmt.Println("Name parsed from speech: " + "`" + username + "`")
+			log.Debug("name parsed from speech", "username", username)
 			intentParam = "username"
 			intentParamValue = username
 			intentParams = map[string]string{intentParam: intentParamValue}
 		} else {
-			fmt.Println("No name parsed from speech")
+			log.Debug("no name parsed from speech")
 			intentParam = "username"
 			intentParamValue = ""
 			intentParams = map[string]string{intentParam: intentParamValue}
@@ -220,7 +214,7 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 		isParam = true
 		newIntent = intent
 		timerSecs := words2num(speechText)
-		fmt.Println("Seconds parsed from speech: " + timerSecs)
+		log.Debug("seconds parsed from speech", "seconds", timerSecs)
 		intentParam = "timer_duration"
 		intentParamValue = timerSecs
 		intentParams = map[string]string{intentParam: intentParamValue}
@@ -235,8 +229,8 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 		isParam = true
 		newIntent = intent
 		intentParam = "given_name"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR)) {
-			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR))
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR, language)) {
+			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR, language))
 			given_name = strings.TrimSpace(splitPhrase[1])
 			if len(splitPhrase) == 3 {
 				given_name = given_name + " " + strings.TrimSpace(splitPhrase[2])
@@ -255,8 +249,8 @@ func ParamChecker(req interface{}, intent string, speechText string, botSerial s
 		isParam = true
 		newIntent = intent
 		intentParam = "given_name"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR)) {
-			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR))
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR, language)) {
+			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR, language))
 			given_name = strings.TrimSpace(splitPhrase[1])
 			if len(splitPhrase) == 3 {
 				given_name = given_name + " " + strings.TrimSpace(splitPhrase[2])
@@ -314,38 +308,19 @@ func ParamCheckerSlotsEnUS(req interface{}, intent string, slots map[string]stri
 	var botUnits string = "F"
 	var botPlaySpecific bool = false
 	var botIsEarlyOpus bool = false
+	log := reqLog(req)
+	ctx := reqContext(req)
 	// see if jdoc exists
-	botJdoc, jdocExists := vars.ReadJdoc("vic:"+botSerial, "vic.RobotSettings")
-	if jdocExists == nil {
-		type robotSettingsJson struct {
-			ButtonWakeword int  `json:"button_wakeword"`
-			Clock24Hour    bool `json:"clock_24_hour"`
-			CustomEyeColor struct {
-				Enabled    bool    `json:"enabled"`
-				Hue        float64 `json:"hue"`
-				Saturation float64 `json:"saturation"`
-			} `json:"custom_eye_color"`
-			DefaultLocation  string `json:"default_location"`
-			DistIsMetric     bool   `json:"dist_is_metric"`
-			EyeColor         int    `json:"eye_color"`
-			Locale           string `json:"locale"`
-			MasterVolume     int    `json:"master_volume"`
-			TempIsFahrenheit bool   `json:"temp_is_fahrenheit"`
-			TimeZone         string `json:"time_zone"`
-		}
-		var robotSettings robotSettingsJson
-		err := json.Unmarshal([]byte(botJdoc.JsonDoc), &robotSettings)
-		if err != nil {
-			fmt.Println("Error unmarshaling json in paramchecker")
-			fmt.Println(err)
+	robotSettings, err := getRobotSettings(ctx, botSerial)
+	if err == nil {
+		botLocation = robotSettings.DefaultLocation
+		if robotSettings.TempIsFahrenheit {
+			botUnits = "F"
 		} else {
-			botLocation = robotSettings.DefaultLocation
-			if robotSettings.TempIsFahrenheit {
-				botUnits = "F"
-			} else {
-				botUnits = "C"
-			}
+			botUnits = "C"
 		}
+	} else if err != vars.ErrUserNotFound {
+		log.Error("error getting robot settings in paramchecker", "error", err)
 	}
 	if strings.Contains(intent, "volume") {
 		if slots["volume"] != "" {
@@ -416,7 +391,7 @@ func ParamCheckerSlotsEnUS(req interface{}, intent string, slots map[string]stri
 		slotUnit := slots["unit"]
 		timerSecs, err := strconv.Atoi(slotNum)
 		if err != nil {
-			fmt.Println(err)
+			log.Warn("invalid timer slot", "num", slotNum, "error", err)
 		}
 		if slotNum != "" && slotUnit != "" {
 			if strings.Contains(slotUnit, "minute") {
@@ -425,7 +400,7 @@ func ParamCheckerSlotsEnUS(req interface{}, intent string, slots map[string]stri
 				timerSecs = timerSecs * 60 * 60
 			}
 		}
-		fmt.Println("Seconds parsed from speech: " + strconv.Itoa(timerSecs))
+		log.Debug("seconds parsed from speech", "seconds", timerSecs)
 		intentParam = "timer_duration"
 		intentParamValue = strconv.Itoa(timerSecs)
 		intentParams = map[string]string{intentParam: intentParamValue}
@@ -444,7 +419,7 @@ func ParamCheckerSlotsEnUS(req interface{}, intent string, slots map[string]stri
 	} else if strings.Contains(intent, "intent_weather_extend") {
 		isParam = true
 		newIntent = intent
-		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser("what's the weather", botLocation, botUnits)
+		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser(ctx, log, "what's the weather", botLocation, botUnits, "en-US")
 		intentParams = map[string]string{
 			"condition":                 condition,
 			"is_forecast":               is_forecast,
@@ -505,7 +480,7 @@ func ParamCheckerSlotsEnUS(req interface{}, intent string, slots map[string]stri
 	IntentPass(req, newIntent, intent, intentParams, isParam)
 }
 
-func prehistoricParamChecker(req interface{}, intent string, speechText string) {
+func prehistoricParamChecker(req interface{}, intent string, speechText string, language string) {
 	// intent.go detects if the stream uses opus or PCM.
 	// If the stream is PCM, it is likely a bot with 0.10.
 	// This accounts for the newer 0.10.1### builds.
@@ -516,10 +491,12 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 	var intentParams map[string]string
 	var botLocation string = "San Francisco"
 	var botUnits string = "F"
+	log := reqLog(req)
+	ctx := reqContext(req)
 	if strings.Contains(intent, "intent_photo_take_extend") {
 		isParam = true
 		newIntent = intent
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_ME)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_SELF)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_US)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_ME, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_SELF, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_US, language)) {
 			intentParam = "entity_photo_selfie"
 			intentParamValue = "photo_selfie"
 		} else {
@@ -532,21 +509,21 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 		isParam = true
 		newIntent = "intent_imperative_eyecolor_specific_extend"
 		intentParam = "eye_color"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_PURPLE)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_PURPLE, language)) {
 			intentParamValue = "COLOR_PURPLE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_BLUE)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_SAPPHIRE)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_BLUE, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_SAPPHIRE, language)) {
 			intentParamValue = "COLOR_BLUE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_YELLOW)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_YELLOW, language)) {
 			intentParamValue = "COLOR_YELLOW"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL2)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_TEAL2, language)) {
 			intentParamValue = "COLOR_TEAL"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_GREEN)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_GREEN, language)) {
 			intentParamValue = "COLOR_GREEN"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_ORANGE)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_ORANGE, language)) {
 			intentParamValue = "COLOR_ORANGE"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_RAINBOW)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_RAINBOW, language)) {
 			intentParamValue = "COLOR_RAINBOW"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_REBUILD)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_EYE_COLOR_REBUILD, language)) {
 			intentParamValue = "COLOR_REBUILD"
 		} else {
 			newIntent = intent
@@ -557,7 +534,7 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 	} else if strings.Contains(intent, "intent_weather_extend") {
 		isParam = true
 		newIntent = intent
-		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser(speechText, botLocation, botUnits)
+		condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := weatherParser(ctx, log, speechText, botLocation, botUnits, language)
 		intentParams = map[string]string{
 			"condition":                 condition,
 			"is_forecast":               is_forecast,
@@ -570,22 +547,22 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 	} else if strings.Contains(intent, "intent_imperative_volumelevel_extend") {
 		isParam = true
 		newIntent = intent
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_LOW)) {
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_LOW, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_2"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOW)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_QUIET)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOW, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_QUIET, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_1"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_HIGH)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM_HIGH, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_4"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NORMAL)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_REGULAR)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MEDIUM, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NORMAL, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_REGULAR, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_3"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_HIGH)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOUD)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_HIGH, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_LOUD, language)) {
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_5"
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MUTE)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NOTHING)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_SILENT)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_OFF)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_ZERO)) {
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_MUTE, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_NOTHING, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_SILENT, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_OFF, language)) || strings.Contains(speechText, lcztn.GetText(lcztn.STR_VOLUME_ZERO, language)) {
 			// there is no VOLUME_0 :(
 			intentParam = "volume_level"
 			intentParamValue = "VOLUME_0"
@@ -599,12 +576,12 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 		var nameSplitter string = ""
 		isParam = true
 		newIntent = "intent_names_username"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS)
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS2)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS2)
-		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS3)) {
-			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS3)
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS, language)
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS2, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS2, language)
+		} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_NAME_IS3, language)) {
+			nameSplitter = lcztn.GetText(lcztn.STR_NAME_IS3, language)
 		}
 		if nameSplitter != "" {
 			splitPhrase := strings.SplitAfter(speechText, nameSplitter)
@@ -616,12 +593,12 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 			} else if len(splitPhrase) > 4 {
 				username = username + " " + strings.TrimSpace(splitPhrase[2]) + " " + strings.TrimSpace(splitPhrase[3])
 			}
-			fmt.Println("Name parsed from speech: " + "`" + username + "`")
+			log.Debug("name parsed from speech", "username", username)
 			intentParam = "username"
 			intentParamValue = username
 			intentParams = map[string]string{intentParam: intentParamValue}
 		} else {
-			fmt.Println("No name parsed from speech")
+			log.Debug("no name parsed from speech")
 			intentParam = "username"
 			intentParamValue = ""
 			intentParams = map[string]string{intentParam: intentParamValue}
@@ -630,7 +607,7 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 		isParam = true
 		newIntent = "intent_clock_settimer"
 		timerSecs := words2num(speechText)
-		fmt.Println("Seconds parsed from speech: " + timerSecs)
+		log.Debug("seconds parsed from speech", "seconds", timerSecs)
 		intentParam = "timer_duration"
 		intentParamValue = timerSecs
 		intentParams = map[string]string{intentParam: intentParamValue}
@@ -645,8 +622,8 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 		isParam = true
 		newIntent = "intent_message_playmessage"
 		intentParam = "given_name"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR)) {
-			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR))
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR, language)) {
+			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR, language))
 			given_name = strings.TrimSpace(splitPhrase[1])
 			if len(splitPhrase) == 3 {
 				given_name = given_name + " " + strings.TrimSpace(splitPhrase[2])
@@ -665,8 +642,8 @@ func prehistoricParamChecker(req interface{}, intent string, speechText string)
 		isParam = true
 		newIntent = "intent_message_recordmessage"
 		intentParam = "given_name"
-		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR)) {
-			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR))
+		if strings.Contains(speechText, lcztn.GetText(lcztn.STR_FOR, language)) {
+			splitPhrase := strings.SplitAfter(speechText, lcztn.GetText(lcztn.STR_FOR, language))
 			given_name = strings.TrimSpace(splitPhrase[1])
 			if len(splitPhrase) == 3 {
 				given_name = given_name + " " + strings.TrimSpace(splitPhrase[2])
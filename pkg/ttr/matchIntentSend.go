@@ -1,15 +1,16 @@
 package wirepod_ttr
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"strings"
 
+	"cavalier/pkg/logging"
 	"cavalier/pkg/vars"
 
 	"cavalier/pkg/vtt"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
-	"github.com/kercre123/wire-pod/chipper/pkg/logger"
 )
 
 type systemIntentResponseStruct struct {
@@ -17,19 +18,57 @@ type systemIntentResponseStruct struct {
 	ReturnIntent string `json:"returnIntent"`
 }
 
+// returns a logger carrying the request's ID and ESN
+func reqLog(req interface{}) *slog.Logger {
+	switch r := req.(type) {
+	case *vtt.IntentRequest:
+		return logging.Request(r.RequestID, r.Device)
+	case *vtt.IntentGraphRequest:
+		return logging.Request(r.RequestID, r.Device)
+	case *vtt.KnowledgeGraphRequest:
+		return logging.Request(r.RequestID, r.Device)
+	case *vtt.TextIntentRequest:
+		return logging.Request(r.RequestID, r.Device)
+	}
+	return slog.Default()
+}
+
+// the context carrying the request's trace span
+func reqContext(req interface{}) context.Context {
+	var ctx context.Context
+	switch r := req.(type) {
+	case *vtt.IntentRequest:
+		ctx = r.Ctx
+	case *vtt.IntentGraphRequest:
+		ctx = r.Ctx
+	case *vtt.KnowledgeGraphRequest:
+		ctx = r.Ctx
+	case *vtt.TextIntentRequest:
+		ctx = r.Ctx
+	}
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
 func IntentPass(req interface{}, intentThing string, speechText string, intentParams map[string]string, isParam bool) (interface{}, error) {
-	var esn string
 	var req1 *vtt.IntentRequest
 	var req2 *vtt.IntentGraphRequest
+	var req3 *vtt.TextIntentRequest
 	var isIntentGraph bool
+	var mode pb.RobotMode
 	if str, ok := req.(*vtt.IntentRequest); ok {
 		req1 = str
-		esn = req1.Device
+		mode = req1.Mode
 		isIntentGraph = false
 	} else if str, ok := req.(*vtt.IntentGraphRequest); ok {
 		req2 = str
-		esn = req2.Device
+		mode = req2.Mode
 		isIntentGraph = true
+	} else if str, ok := req.(*vtt.TextIntentRequest); ok {
+		req3 = str
+		mode = req3.Mode
 	}
 
 	var intentResult pb.IntentResult
@@ -45,56 +84,61 @@ func IntentPass(req interface{}, intentThing string, speechText string, intentPa
 			Action:    intentThing,
 		}
 	}
-	logger.LogUI("Intent matched: " + intentThing + ", transcribed text: '" + speechText + "', device: " + esn)
+	log := reqLog(req).With("intent", intentThing)
 	if isParam {
-		logger.LogUI("Parameters sent: " + fmt.Sprint(intentParams))
+		log = log.With("params", intentParams)
 	}
+	// answer in the mode the robot asked in, so a game's answer goes back to the game
 	intent := pb.IntentResponse{
 		IsFinal:      true,
 		IntentResult: &intentResult,
+		Mode:         mode,
 	}
 	intentGraphSend := pb.IntentGraphResponse{
 		ResponseType: pb.IntentGraphMode_INTENT,
 		IsFinal:      true,
 		IntentResult: &intentResult,
-		CommandType:  pb.RobotMode_VOICE_COMMAND.String(),
+		Mode:         mode,
+		CommandType:  mode.String(),
 	}
-	if !isIntentGraph {
+	if req3 != nil {
+		// text intents have no stream, the RPC handler returns the response
+		req3.Response = &intent
+		log.Info("text intent matched", "text", speechText)
+		return &vtt.IntentResponse{Intent: &intent}, nil
+	} else if !isIntentGraph {
+		req1.Result = &intentResult
 		if err := req1.Stream.Send(&intent); err != nil {
+			log.Error("failed to send intent", "error", err)
 			return nil, err
 		}
 		r := &vtt.IntentResponse{
 			Intent: &intent,
 		}
-		fmt.Println("Bot " + esn + " Intent Sent: " + intentThing)
-		if isParam {
-			fmt.Println("Bot "+esn+" Parameters Sent:", intentParams)
-		} else {
-			fmt.Println("No Parameters Sent")
-		}
+		log.Info("intent sent", "text", speechText)
 		return r, nil
 	} else {
+		req2.Result = &intentResult
 		if err := req2.Stream.Send(&intentGraphSend); err != nil {
+			log.Error("failed to send intent", "error", err)
 			return nil, err
 		}
 		r := &vtt.IntentGraphResponse{
 			Intent: &intentGraphSend,
 		}
-		fmt.Println("Bot " + esn + " Intent Sent: " + intentThing)
-		if isParam {
-			fmt.Println("Bot "+esn+" Parameters Sent:", intentParams)
-		} else {
-			fmt.Println("No Parameters Sent")
-		}
+		log.Info("intent sent", "text", speechText)
 		return r, nil
 	}
 }
 
-func ProcessTextAll(req interface{}, voiceText string, intents []vars.JsonIntent, isOpus bool) bool {
+// ProcessTextAll matches voiceText against the intents of language, and sends the match with its parameters
+func ProcessTextAll(req interface{}, voiceText string, language string, isOpus bool) bool {
+	intents := vars.Intents(language)
 	var botSerial string
 	var req2 *vtt.IntentRequest
 	var req1 *vtt.KnowledgeGraphRequest
 	var req3 *vtt.IntentGraphRequest
+	var req4 *vtt.TextIntentRequest
 	if str, ok := req.(*vtt.IntentRequest); ok {
 		req2 = str
 		botSerial = req2.Device
@@ -104,21 +148,24 @@ func ProcessTextAll(req interface{}, voiceText string, intents []vars.JsonIntent
 	} else if str, ok := req.(*vtt.IntentGraphRequest); ok {
 		req3 = str
 		botSerial = req3.Device
+	} else if str, ok := req.(*vtt.TextIntentRequest); ok {
+		req4 = str
+		botSerial = req4.Device
 	}
 	var matched int = 0
 	var intentNum int = 0
 	var successMatched bool = false
 	voiceText = strings.ToLower(voiceText)
-	fmt.Println("Not a custom intent")
+	log := reqLog(req)
 	// Look for a perfect match first
 	for _, b := range intents {
 		for _, c := range b.Keyphrases {
 			if voiceText == strings.ToLower(c) {
-				fmt.Println("Bot " + botSerial + " Perfect match for intent " + b.Name + " (" + strings.ToLower(c) + ")")
+				log.Debug("perfect match", "intent", b.Name, "keyphrase", strings.ToLower(c))
 				if isOpus {
-					ParamChecker(req, b.Name, voiceText, botSerial)
+					ParamChecker(req, b.Name, voiceText, botSerial, language)
 				} else {
-					prehistoricParamChecker(req, b.Name, voiceText)
+					prehistoricParamChecker(req, b.Name, voiceText, language)
 				}
 				successMatched = true
 				matched = 1
@@ -138,11 +185,11 @@ func ProcessTextAll(req interface{}, voiceText string, intents []vars.JsonIntent
 		for _, b := range intents {
 			for _, c := range b.Keyphrases {
 				if strings.Contains(voiceText, strings.ToLower(c)) && !b.RequireExactMatch {
-					fmt.Println("Bot " + botSerial + " Partial match for intent " + b.Name + " (" + strings.ToLower(c) + ")")
+					log.Debug("partial match", "intent", b.Name, "keyphrase", strings.ToLower(c))
 					if isOpus {
-						ParamChecker(req, b.Name, voiceText, botSerial)
+						ParamChecker(req, b.Name, voiceText, botSerial, language)
 					} else {
-						prehistoricParamChecker(req, b.Name, voiceText)
+						prehistoricParamChecker(req, b.Name, voiceText, language)
 					}
 					successMatched = true
 					matched = 1
@@ -171,7 +218,8 @@ func KnowledgeGraphResponseIG(req *vtt.IntentGraphRequest, spokenText string, qu
 		IntentResult: &intentResult,
 		SpokenText:   spokenText,
 		QueryText:    queryText,
-		CommandType:  pb.RobotMode_VOICE_COMMAND.String(),
+		Mode:         req.Mode,
+		CommandType:  req.Mode.String(),
 	}
 
 	if err := req.Stream.Send(&intentGraphSend); err != nil {
@@ -1,9 +1,12 @@
 package wirepod_ttr
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"net/http"
 	"net/url"
@@ -13,9 +16,16 @@ import (
 	"time"
 	"unicode"
 
+	"cavalier/pkg/metrics"
+	"cavalier/pkg/tracing"
 	"cavalier/pkg/vars"
 
 	lcztn "cavalier/pkg/localization"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 /* TODO:
@@ -159,7 +169,37 @@ type openWeatherMapForecastAPIResponseStruct struct {
 	List    []openWeatherMapAPIResponseStruct `json:"list"`
 }
 
-func getWeather(location string, botUnits string, hoursFromNow int) (string, string, string, string, string, string, string) {
+// weather API calls get client spans. the query string holds the API key, so it's taken off the
+// request otelhttp sees and put back underneath it
+var weatherClient = &http.Client{
+	Transport: hideQuery{otelhttp.NewTransport(restoreQuery{http.DefaultTransport})},
+	Timeout:   10 * time.Second,
+}
+
+type queryKey struct{}
+
+type hideQuery struct{ next http.RoundTripper }
+
+func (t hideQuery) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.RawQuery == "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(context.WithValue(req.Context(), queryKey{}, req.URL.RawQuery))
+	req.URL.RawQuery = ""
+	return t.next.RoundTrip(req)
+}
+
+type restoreQuery struct{ next http.RoundTripper }
+
+func (t restoreQuery) RoundTrip(req *http.Request) (*http.Response, error) {
+	if query, ok := req.Context().Value(queryKey{}).(string); ok {
+		req = req.Clone(req.Context())
+		req.URL.RawQuery = query
+	}
+	return t.next.RoundTrip(req)
+}
+
+func getWeather(ctx context.Context, log *slog.Logger, location string, botUnits string, hoursFromNow int) (string, string, string, string, string, string, string) {
 	var weatherEnabled bool
 	var condition string
 	var raw_condition string
@@ -168,37 +208,43 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 	var speakable_location_string string
 	var temperature string
 	var temperature_unit string
-	weatherAPIEnabled := vars.APIConfig.Weather.Enable
-	weatherAPIKey := vars.APIConfig.Weather.Key
-	weatherAPIUnit := "F"
-	weatherAPIProvider := "weatherapi.com"
+	weatherConfig := vars.Config().Weather
+	weatherAPIEnabled := weatherConfig.Enable
+	weatherAPIKey := weatherConfig.Key
+	weatherAPIUnit := weatherConfig.Unit
+	weatherAPIProvider := weatherConfig.Provider
 	if weatherAPIEnabled && weatherAPIKey != "" {
 		weatherEnabled = true
 	} else {
 		weatherEnabled = false
 	}
 	if weatherEnabled {
-		if botUnits != "" {
-			if botUnits == "F" {
-				weatherAPIUnit = "F"
-			} else if botUnits == "C" {
-				weatherAPIUnit = "C"
-			}
-		} else if weatherAPIUnit != "F" && weatherAPIUnit != "C" {
+		// the robot's own setting unless the config forces one
+		if weatherAPIUnit == "" {
+			weatherAPIUnit = botUnits
+		}
+		if weatherAPIUnit != "F" && weatherAPIUnit != "C" {
 			weatherAPIUnit = "F"
 		}
 	}
 
 	if weatherEnabled {
+		defer metrics.ObserveStage(metrics.StageWeather, time.Now())
+		var span trace.Span
+		ctx, span = otel.Tracer("cavalier").Start(ctx, "weather", trace.WithAttributes(attribute.String("weather.provider", weatherAPIProvider)))
+		defer span.End()
 		if weatherAPIProvider == "weatherapi.com" {
 			params := url.Values{}
 			params.Add("key", weatherAPIKey)
 			params.Add("q", location)
 			params.Add("aqi", "no")
 			url := "http://api.weatherapi.com/v1/current.json"
-			resp, err := http.PostForm(url, params)
+			resp, err := weatherRequest(ctx, http.MethodPost, url, params)
 			if err != nil {
-				panic(err)
+				log.Error("weather request failed", "provider", weatherAPIProvider, "error", err)
+				tracing.RecordError(span, err)
+				metrics.ProviderErrors.WithLabelValues(weatherAPIProvider).Inc()
+				return weatherUnavailable(location)
 			}
 			defer resp.Body.Close()
 			body, _ := io.ReadAll(resp.Body)
@@ -235,7 +281,13 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 			// First use geocoding api to convert location into coordinates
 			// E.G. http://api.openweathermap.org/geo/1.0/direct?q={city name},{state code},{country code}&limit={limit}&appid={API key}
 			url := "http://api.openweathermap.org/geo/1.0/direct?q=" + url.QueryEscape(location) + "&limit=1&appid=" + weatherAPIKey
-			resp, err := http.Get(url)
+			resp, err := weatherRequest(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				log.Error("weather geocoding request failed", "provider", weatherAPIProvider, "error", err)
+				tracing.RecordError(span, err)
+				metrics.ProviderErrors.WithLabelValues(weatherAPIProvider).Inc()
+				return weatherUnavailable(location)
+			}
 			defer resp.Body.Close()
 			body, _ := io.ReadAll(resp.Body)
 			geoCodingResponse := string(body)
@@ -245,13 +297,8 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 			err = json.Unmarshal([]byte(geoCodingResponse), &geoCodingInfoStruct)
 
 			if len(geoCodingInfoStruct) == 0 {
-				condition = "undefined"
-				is_forecast = "false"
-				local_datetime = "test"              // preferably local time in UTC ISO 8601 format ("2022-06-15 12:21:22.123")
-				speakable_location_string = location // preferably the processed location
-				temperature = "120"
-				temperature_unit = "C"
-				return condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, ""
+				log.Warn("weather location not found", "provider", weatherAPIProvider, "location", location, "error", err)
+				return weatherUnavailable(location)
 			}
 			Lat := fmt.Sprintf("%f", geoCodingInfoStruct[0].Lat)
 			Lon := fmt.Sprintf("%f", geoCodingInfoStruct[0].Lon)
@@ -266,9 +313,12 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 			} else {
 				url = "https://api.openweathermap.org/data/2.5/forecast?lat=" + Lat + "&lon=" + Lon + "&units=" + units + "&appid=" + weatherAPIKey
 			}
-			resp, err = http.Get(url)
+			resp, err = weatherRequest(ctx, http.MethodGet, url, nil)
 			if err != nil {
-				panic(err)
+				log.Error("weather request failed", "provider", weatherAPIProvider, "error", err)
+				tracing.RecordError(span, err)
+				metrics.ProviderErrors.WithLabelValues(weatherAPIProvider).Inc()
+				return weatherUnavailable(location)
 			}
 			defer resp.Body.Close()
 			body, _ = io.ReadAll(resp.Body)
@@ -279,14 +329,19 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 				// Forecast request: free API results are returned in 3 hours slots
 				var openWeatherMapForecastAPIResponse openWeatherMapForecastAPIResponseStruct
 				err = json.Unmarshal([]byte(weatherResponse), &openWeatherMapForecastAPIResponse)
-				openWeatherMapAPIResponse = openWeatherMapForecastAPIResponse.List[hoursFromNow/3]
+				if err == nil && hoursFromNow/3 < len(openWeatherMapForecastAPIResponse.List) {
+					openWeatherMapAPIResponse = openWeatherMapForecastAPIResponse.List[hoursFromNow/3]
+				}
 			} else {
 				// Current weather request
 				err = json.Unmarshal([]byte(weatherResponse), &openWeatherMapAPIResponse)
 			}
 
-			if err != nil {
-				panic(err)
+			if err != nil || len(openWeatherMapAPIResponse.Weather) == 0 {
+				log.Error("invalid weather response", "provider", weatherAPIProvider, "error", err)
+				tracing.RecordError(span, errors.New("invalid weather response"))
+				metrics.ProviderErrors.WithLabelValues(weatherAPIProvider).Inc()
+				return weatherUnavailable(location)
 			}
 
 			conditionCode := openWeatherMapAPIResponse.Weather[0].Id
@@ -336,6 +391,8 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 				temperature_unit = "F"
 			}
 		}
+		log.Debug("weather fetched", "provider", weatherAPIProvider, "location", location, "hours_from_now", hoursFromNow,
+			"condition", condition, "temperature", temperature, "unit", temperature_unit)
 	} else {
 		condition = "Snow"
 		is_forecast = "false"
@@ -347,15 +404,39 @@ func getWeather(location string, botUnits string, hoursFromNow int) (string, str
 	return condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition
 }
 
-func weatherParser(speechText string, botLocation string, botUnits string) (string, string, string, string, string, string, string) {
+// what the robot gets when the weather couldn't be fetched
+// sends a weather API request with the request's context, so it's traced and cancelled with it.
+// params are sent as a form
+func weatherRequest(ctx context.Context, method string, endpoint string, params url.Values) (*http.Response, error) {
+	var body io.Reader
+	if params != nil {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if params != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return weatherClient.Do(req)
+}
+
+func weatherUnavailable(location string) (string, string, string, string, string, string, string) {
+	// local_datetime is preferably local time in UTC ISO 8601 format ("2022-06-15 12:21:22.123"),
+	// the location preferably the processed one
+	return "undefined", "false", "test", location, "120", "C", ""
+}
+
+func weatherParser(ctx context.Context, log *slog.Logger, speechText string, botLocation string, botUnits string, language string) (string, string, string, string, string, string, string) {
 	var specificLocation bool
 	var apiLocation string
 	var speechLocation string
 	var hoursFromNow int
-	if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_IN)) {
-		splitPhrase := strings.SplitAfter(removeEndPunctuation(speechText), lcztn.GetText(lcztn.STR_WEATHER_IN))
+	if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_IN, language)) {
+		splitPhrase := strings.SplitAfter(removeEndPunctuation(speechText), lcztn.GetText(lcztn.STR_WEATHER_IN, language))
 		speechLocation = strings.TrimSpace(splitPhrase[1])
-		if os.Getenv("STT_SERVICE") != "whisper.cpp" {
+		if !formattedSTT() {
 			if len(splitPhrase) == 3 {
 				speechLocation = speechLocation + " " + strings.TrimSpace(splitPhrase[2])
 			} else if len(splitPhrase) == 4 {
@@ -376,18 +457,18 @@ func weatherParser(speechText string, botLocation string, botUnits string) (stri
 	}
 	hoursFromNow = 0
 	hours, _, _ := time.Now().Clock()
-	if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_THIS_AFTERNOON)) {
+	if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_THIS_AFTERNOON, language)) {
 		if hours < 14 {
 			hoursFromNow = 14 - hours
 		}
-	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_TONIGHT)) {
+	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_TONIGHT, language)) {
 		if hours < 20 {
 			hoursFromNow = 20 - hours
 		}
-	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_THE_DAY_AFTER_TOMORROW)) {
+	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_THE_DAY_AFTER_TOMORROW, language)) {
 		hoursFromNow = 24 - hours + 24 + 9
-	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_FORECAST)) ||
-		strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_TOMORROW)) {
+	} else if strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_FORECAST, language)) ||
+		strings.Contains(speechText, lcztn.GetText(lcztn.STR_WEATHER_TOMORROW, language)) {
 		hoursFromNow = 24 - hours + 9
 	}
 
@@ -397,6 +478,6 @@ func weatherParser(speechText string, botLocation string, botUnits string) (stri
 		apiLocation = botLocation
 	}
 	// call to weather API
-	condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := getWeather(apiLocation, botUnits, hoursFromNow)
+	condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition := getWeather(ctx, log, apiLocation, botUnits, hoursFromNow)
 	return condition, is_forecast, local_datetime, speakable_location_string, temperature, temperature_unit, raw_condition
 }
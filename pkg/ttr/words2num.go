@@ -1,10 +1,11 @@
 package wirepod_ttr
 
 import (
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"cavalier/pkg/stt"
 )
 
 // This file contains words2num. It is given the spoken text and returns a string which contains the true number.
@@ -45,9 +46,15 @@ var textToNumber = map[string]int{
 	"thirty": 30, "forty": 40, "fifty": 50, "sixty": 60,
 }
 
+// whether the engine in use writes numbers as digits and punctuates, like whisper
+func formattedSTT() bool {
+	e := stt.Active()
+	return e != nil && e.Capabilities().Formatted
+}
+
 func words2num(input string) string {
 	containsNum, _ := regexp.MatchString(`\b\d+\b`, input)
-	if os.Getenv("STT_SERVICE") == "whisper.cpp" && containsNum {
+	if formattedSTT() && containsNum {
 		return whisperSpeechtoNum(input)
 	}
 	totalSeconds := 0
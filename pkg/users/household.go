@@ -0,0 +1,38 @@
+package users
+
+import (
+	"cavalier/pkg/vars"
+	"errors"
+	"sync/atomic"
+)
+
+// in LAN mode there's no signup. every robot goes on one household account, which logins
+// without a username get and the token server falls back to
+
+var household atomic.Pointer[vars.UserInDB]
+
+// EnsureHousehold makes the account for email if there isn't one and uses it as the household.
+// a new account gets a random password, so nobody can log in to it with one until it's reset
+func EnsureHousehold(email string) (vars.UserInDB, error) {
+	user, err := getUser(email)
+	if err == vars.ErrUserNotFound {
+		err = CreateUser(email, vars.GenerateID()+vars.GenerateID(), "2000-01-01")
+		if err == nil || err == vars.ErrUserAlreadyExists {
+			user, err = getUser(email)
+		}
+	}
+	if err != nil {
+		return vars.UserInDB{}, errors.New("EnsureHousehold: " + err.Error())
+	}
+	household.Store(&user)
+	return user, nil
+}
+
+// Household is the household account, if LAN mode set one up
+func Household() (vars.UserInDB, bool) {
+	user := household.Load()
+	if user == nil {
+		return vars.UserInDB{}, false
+	}
+	return *user, true
+}
@@ -1,20 +1,26 @@
 package users
 
 import (
+	"cavalier/pkg/metrics"
 	"cavalier/pkg/vars"
 	"database/sql"
 	"errors"
 	"regexp"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var db *sql.DB
-var dbMutex sync.Mutex
+
+// satisfied by both *sql.DB and *sql.Tx, so lookups can run inside or outside a transaction
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
 
 func Init(dbConn *sql.DB) {
 	db = dbConn
@@ -46,8 +52,13 @@ func Init(dbConn *sql.DB) {
 }
 
 func GetUUIDFromEmail(email string) (string, error) {
+	defer metrics.ObserveDB("users", "get_uuid_from_email", time.Now())
+	return getUUIDFromEmail(db, email)
+}
+
+func getUUIDFromEmail(q querier, email string) (string, error) {
 	var userUUID string
-	err := db.QueryRow("SELECT uuid FROM cavalier_users WHERE email = ?", email).Scan(&userUUID)
+	err := q.QueryRow("SELECT uuid FROM cavalier_users WHERE email = ?", email).Scan(&userUUID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", vars.ErrUserNotFound
@@ -59,8 +70,13 @@ func GetUUIDFromEmail(email string) (string, error) {
 }
 
 func GetUserFromUUID(uuid string) (vars.UserInDB, error) {
+	defer metrics.ObserveDB("users", "get_user_from_uuid", time.Now())
+	return getUserFromUUID(db, uuid)
+}
+
+func getUserFromUUID(q querier, uuid string) (vars.UserInDB, error) {
 	var user vars.UserInDB
-	err := db.QueryRow("SELECT uuid, userid, email, hashed_pw, date_of_birth FROM cavalier_users WHERE uuid = ?", uuid).Scan(&user.UUID, &user.UserID, &user.Email, &user.HashedPW, &user.DOB)
+	err := q.QueryRow("SELECT uuid, userid, email, hashed_pw, date_of_birth FROM cavalier_users WHERE uuid = ?", uuid).Scan(&user.UUID, &user.UserID, &user.Email, &user.HashedPW, &user.DOB)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return vars.UserInDB{}, vars.ErrUserNotFound
@@ -68,13 +84,18 @@ func GetUserFromUUID(uuid string) (vars.UserInDB, error) {
 		return vars.UserInDB{}, err
 	}
 
-	user.ESNs, _ = GetESNsForUser(user.UserID)
+	user.ESNs, _ = getESNsForUser(q, user.UserID)
 
 	return user, nil
 }
 
 func GetESNsForUser(userID string) ([]string, error) {
-	rows, err := db.Query("SELECT esn FROM user_robots WHERE user_id = ?", userID)
+	defer metrics.ObserveDB("users", "get_esns_for_user", time.Now())
+	return getESNsForUser(db, userID)
+}
+
+func getESNsForUser(q querier, userID string) ([]string, error) {
+	rows, err := q.Query("SELECT esn FROM user_robots WHERE user_id = ?", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +117,26 @@ func GetESNsForUser(userID string) ([]string, error) {
 	return esns, nil
 }
 
+// GetUsersForRobot returns the IDs of every account a robot ("vic:<esn>") is associated with
+func GetUsersForRobot(thing string) ([]string, error) {
+	defer metrics.ObserveDB("users", "get_users_for_robot", time.Now())
+	rows, err := db.Query("SELECT user_id FROM user_robots WHERE esn = ?", thing)
+	if err != nil {
+		return nil, errors.New("GetUsersForRobot: " + err.Error())
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, errors.New("GetUsersForRobot: " + err.Error())
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
 func AuthUser(email string, password string) (vars.UserInDB, error) {
 	if email == "" || password == "" {
 		return vars.UserInDB{}, vars.ErrBadCredentials
@@ -111,13 +152,19 @@ func AuthUser(email string, password string) (vars.UserInDB, error) {
 }
 
 func getUser(email string) (vars.UserInDB, error) {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-	uuid, err := GetUUIDFromEmail(email)
+	defer metrics.ObserveDB("users", "get_user", time.Now())
+	// the lookup is three queries, a transaction keeps them on one snapshot.
+	// it only ever reads, so it never takes the write lock and logins don't wait on writers
+	tx, err := db.Begin()
 	if err != nil {
 		return vars.UserInDB{}, err
 	}
-	user, err := GetUserFromUUID(uuid)
+	defer tx.Rollback()
+	uuid, err := getUUIDFromEmail(tx, email)
+	if err != nil {
+		return vars.UserInDB{}, err
+	}
+	user, err := getUserFromUUID(tx, uuid)
 	if err != nil {
 		return vars.UserInDB{}, err
 	}
@@ -169,11 +216,14 @@ func CreateUser(email, password, dateOfBirth string) error {
 	if err != nil {
 		return errors.New("CreateUser: failed to generate password hash: " + err.Error())
 	}
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
+	// email is UNIQUE, so if someone else registered it since the check above the insert fails instead of duplicating
+	insertStart := time.Now()
 	_, err = db.Exec("INSERT INTO cavalier_users (uuid, userid, email, hashed_pw, date_of_birth) VALUES (?, ?, ?, ?, ?)", uuid.New().String(), vars.GenerateID(), email, string(pw), dateOfBirth)
+	metrics.ObserveDB("users", "create_user", insertStart)
 	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return vars.ErrUserAlreadyExists
+		}
 		return errors.New("CreateUser: failed to insert user into db: " + err.Error())
 	}
 
@@ -199,21 +249,22 @@ func ResetPassword(email, oldPassword, newPassword string) error {
 		return errors.New("ResetPassword: failed to generate new password hash: " + err.Error())
 	}
 
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
-	_, err = db.Exec("UPDATE cavalier_users SET hashed_pw = ? WHERE email = ?", string(newHashedPw), email)
+	// only update if the hash is still the one the old password was checked against
+	updateStart := time.Now()
+	result, err := db.Exec("UPDATE cavalier_users SET hashed_pw = ? WHERE email = ? AND hashed_pw = ?", string(newHashedPw), email, user.HashedPW)
+	metrics.ObserveDB("users", "reset_password", updateStart)
 	if err != nil {
 		return errors.New("ResetPassword: failed to update password: " + err.Error())
 	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return vars.ErrBadCredentials
+	}
 
 	return nil
 }
 
 func RemoveUser(email string) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
+	defer metrics.ObserveDB("users", "remove_user", time.Now())
 	result, err := db.Exec("DELETE FROM cavalier_users WHERE email = ?", email)
 	if err != nil {
 		return errors.New("RemoveUser: failed to delete user: " + err.Error())
@@ -232,33 +283,28 @@ func RemoveUser(email string) error {
 }
 
 func AssociateRobotWithAccount(esn string, userID string) error {
+	defer metrics.ObserveDB("users", "associate_robot", time.Now())
 	if userID == "notauser" {
 		return nil
 	}
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
-	// Check if the user exists
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM cavalier_users WHERE userid = ?", userID).Scan(&count)
-	if err != nil || count == 0 {
-		return errors.New("AssociateRobotWithAccount: user not found")
-	}
-
-	_, err = db.Exec("INSERT INTO user_robots (esn, user_id) VALUES (?, ?)", esn, userID)
+	// one statement, so the user can't disappear between the check and the insert
+	result, err := db.Exec("INSERT INTO user_robots (esn, user_id) SELECT ?, ? WHERE EXISTS (SELECT 1 FROM cavalier_users WHERE userid = ?)", esn, userID, userID)
 	if err != nil {
 		return errors.New("AssociateRobotWithAccount: failed to associate robot with user: " + err.Error())
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return errors.New("AssociateRobotWithAccount: user not found")
+	}
 
 	return nil
 }
 
 func IsRobotAssociatedWithAccount(esn string, userID string) bool {
+	defer metrics.ObserveDB("users", "is_robot_associated", time.Now())
 	if userID == "notauser" {
 		return true
 	}
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
 
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM user_robots WHERE esn = ? AND user_id = ?", esn, userID).Scan(&count)
@@ -0,0 +1,60 @@
+package users
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"cavalier/pkg/vars"
+)
+
+// login and association throughput under concurrency, against a throwaway database opened the
+// same way the server opens it (WAL, busy timeout).
+//
+//	go test ./pkg/users -run '^$' -bench . -cpu 1,4,16
+
+const benchPassword = "benchpassword"
+
+func benchUsers(b *testing.B, n int) []string {
+	b.Helper()
+	db, err := vars.OpenDB(filepath.Join(b.TempDir(), "user_database.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	Init(db)
+	emails := make([]string, n)
+	for i := range emails {
+		emails[i] = "bench" + strconv.Itoa(i) + "@example.com"
+		if err := CreateUser(emails[i], benchPassword, "2000-01-01"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return emails
+}
+
+func BenchmarkLogin(b *testing.B) {
+	emails := benchUsers(b, 20)
+	var counter atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			email := emails[counter.Add(1)%uint64(len(emails))]
+			if _, err := AuthUser(email, benchPassword); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkIsRobotAssociated(b *testing.B) {
+	benchUsers(b, 1)
+	var counter atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			IsRobotAssociatedWithAccount(vars.Thingifier(strconv.FormatUint(counter.Add(1)%200, 16)), "nobody")
+		}
+	})
+}
@@ -0,0 +1,758 @@
+package vars
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the server is configured from one JSON file, ./cavalier.json unless CAVALIER_CONFIG points
+// somewhere else. anything the file leaves out keeps its default (see cavalier.example.json),
+// and the environment variables in envOverrides take precedence over the file.
+
+// taken before Init replaces the package defaults with the loaded values
+var defaults = defaultConfig()
+
+// the running config, the intent lists for its languages and where the config came from. it's
+// replaced whole, never modified in place, so a request sees one consistent version even across
+// a reload
+type snapshot struct {
+	config  *APIConfig
+	intents map[string][]JsonIntent
+	source  string
+	// anything worth warning about once logging is up
+	warnings []string
+}
+
+var current atomic.Pointer[snapshot]
+
+func init() {
+	c := defaults
+	current.Store(&snapshot{config: &c})
+}
+
+// swaps in a copy of the running snapshot changed by update. the caller holds reloadMu
+func publish(update func(s *snapshot)) {
+	s := *current.Load()
+	update(&s)
+	current.Store(&s)
+}
+
+// Config returns the running config. it must not be modified, see UpdateConfig
+func Config() *APIConfig {
+	return current.Load().config
+}
+
+// UpdateConfig replaces the running config with a copy changed by update
+func UpdateConfig(update func(c *APIConfig)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	publish(func(s *snapshot) {
+		c := *s.config
+		update(&c)
+		s.config = &c
+	})
+}
+
+// ConfigSource is where the running config came from
+func ConfigSource() string {
+	return current.Load().source
+}
+
+// ConfigWarnings are the problems found loading the running config that didn't stop it loading
+func ConfigWarnings() []string {
+	return current.Load().warnings
+}
+
+type APIConfig struct {
+	Server struct {
+		// false for ip, true for escape pod (LAN mode, see the lan section)
+		EPConfig        bool   `json:"epconfig"`
+		ChipperAddr     string `json:"chipper_addr"`
+		AccountsAddr    string `json:"accounts_addr"`
+		AccountsTLSAddr string `json:"accounts_tls_addr"`
+		Cert            string `json:"cert"`
+		Key             string `json:"key"`
+		// the CA robots should trust, for server config bundles
+		CA string `json:"ca"`
+		// the hostname (or address) robots reach cavalier on
+		PublicHost      string `json:"public_host"`
+		AdminKey        string `json:"admin_key"`
+		MetricsAddr     string `json:"metrics_addr"`
+		ShutdownTimeout int    `json:"shutdown_timeout_ms"`
+	} `json:"server"`
+	Database struct {
+		UserDB       string `json:"user_db"`
+		JdocsDB      string `json:"jdocs_db"`
+		SessionCerts string `json:"session_certs"`
+		MaxOpenConns int    `json:"max_open_conns"`
+		MaxIdleConns int    `json:"max_idle_conns"`
+		ConnMaxIdle  int    `json:"conn_max_idle_ms"`
+		BusyTimeout  int    `json:"busy_timeout_ms"`
+		Synchronous  string `json:"synchronous"`
+	} `json:"database"`
+	STT struct {
+		// the STT engine, out of the ones built in. empty is fine when only one of them is local
+		Service string `json:"provider"`
+		// the default, for robots whose language isn't loaded
+		Language string `json:"language"`
+		// loaded next to language. each request uses its robot's language if it's one of these
+		Languages    []string `json:"languages"`
+		VoskGrammer  bool     `json:"vosk_grammer"`
+		MaxUtterance int      `json:"max_utterance_ms"`
+		StreamIdle   int      `json:"stream_idle_ms"`
+	} `json:"STT"`
+	VAD struct {
+		SpeechThreshold float64 `json:"speech_threshold"`
+		MinSilence      int     `json:"min_silence_ms"`
+		SpeechPad       int     `json:"speech_pad_ms"`
+	} `json:"vad"`
+	// the whisper.cpp engine. a change is picked up by a reload
+	Whisper struct {
+		// a ggml model file, or a name like base.en for ./whisper/ggml-base.en.bin
+		Model string `json:"model"`
+		// requests decoded at once. each context loads its own copy of the model
+		Contexts int `json:"contexts"`
+		// per context, 0 for one per CPU
+		Threads int `json:"threads"`
+		// greedy or beam_search
+		Sampling string `json:"sampling"`
+		// with beam_search
+		BeamSize int `json:"beam_size"`
+		// how long a request waits for a free context before it fails
+		PoolTimeout int `json:"pool_timeout_ms"`
+	} `json:"whisper"`
+	// the whisper-api engine, for an OpenAI-compatible transcription server
+	WhisperAPI struct {
+		// up to and including /v1, like https://api.openai.com/v1
+		BaseURL string `json:"base_url"`
+		// sent as a bearer token if set
+		Key   string `json:"key"`
+		Model string `json:"model"`
+		// sent with every request, like en. empty sends each request's own language
+		Language string `json:"language"`
+		// words to steer the transcription toward, like the robot's name
+		Prompt string `json:"prompt"`
+		// per attempt
+		Timeout int `json:"timeout_ms"`
+		// more attempts after a timeout, a network error, a 429 or a 5xx
+		Retries int `json:"retries"`
+	} `json:"whisper_api"`
+	Knowledge struct {
+		Enable                 bool   `json:"enable"`
+		Provider               string `json:"provider"`
+		Key                    string `json:"key"`
+		ID                     string `json:"id"`
+		Model                  string `json:"model"`
+		IntentGraph            bool   `json:"intentgraph"`
+		RobotName              string `json:"robotName"`
+		OpenAIPrompt           string `json:"openai_prompt"`
+		OpenAIVoice            string `json:"openai_voice"`
+		OpenAIVoiceWithEnglish bool   `json:"openai_voice_with_english"`
+		SaveChat               bool   `json:"save_chat"`
+		CommandsEnable         bool   `json:"commands_enable"`
+		Endpoint               string `json:"endpoint"`
+		Timeout                int    `json:"timeout_ms"`
+	} `json:"knowledge"`
+	Weather struct {
+		Enable   bool   `json:"enable"`
+		Provider string `json:"provider"`
+		Key      string `json:"key"`
+		// F or C. empty follows each robot's own setting
+		Unit string `json:"unit"`
+	} `json:"weather"`
+	Blacklist struct {
+		Enable        bool     `json:"enable"`
+		EnableStealth bool     `json:"enableStealth"`
+		ESNs          []string `json:"esns"`
+	} `json:"blacklist"`
+	Quotas struct {
+		Path string `json:"path"`
+	} `json:"quotas"`
+	Recording struct {
+		Path          string `json:"path"`
+		RetentionDays int    `json:"retention_days"`
+		MaxMB         int64  `json:"max_mb"`
+	} `json:"recording"`
+	Cache struct {
+		RobotSettings          int `json:"robot_settings"`
+		ConnectionCheckHistory int `json:"connection_check_history"`
+	} `json:"cache"`
+	Logging struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	} `json:"logging"`
+	Tracing struct {
+		Endpoint    string  `json:"endpoint"`
+		ServiceName string  `json:"service_name"`
+		SampleRatio float64 `json:"sample_ratio"`
+	} `json:"tracing"`
+	Dev struct {
+		// a self-signed CA and certificate instead of server.cert and server.key, see certs.EnsureDev
+		Enable bool     `json:"enable"`
+		Hosts  []string `json:"hosts"`
+	} `json:"dev"`
+	LAN struct {
+		// advertised over mDNS as <hostname>.local. escape pod firmware looks for escapepod.local
+		Hostname string `json:"hostname"`
+		// email of the account every robot is put on when nobody logs in
+		Household string `json:"household"`
+	} `json:"lan"`
+}
+
+// the config before any file or environment variable is applied, built from the package defaults
+func defaultConfig() APIConfig {
+	var c APIConfig
+	c.Server.ChipperAddr = ChipperAddr
+	c.Server.AccountsAddr = AccountsAddr
+	c.Server.ShutdownTimeout = int(ShutdownTimeout / time.Millisecond)
+
+	c.Database.UserDB = UserDBPath
+	c.Database.JdocsDB = JdocsDBPath
+	c.Database.SessionCerts = SessionCertsStorage
+	c.Database.MaxOpenConns = DBMaxOpenConns
+	c.Database.MaxIdleConns = DBMaxIdleConns
+	c.Database.ConnMaxIdle = int(DBConnMaxIdle / time.Millisecond)
+	c.Database.BusyTimeout = DBBusyTimeoutMs
+	c.Database.Synchronous = DBSynchronousOpt
+
+	c.STT.Language = "en-US"
+	c.STT.Languages = []string{}
+	c.STT.MaxUtterance = int(MaxUtteranceLength / time.Millisecond)
+	c.STT.StreamIdle = int(StreamIdleTimeout / time.Millisecond)
+
+	c.VAD.SpeechThreshold = 0.5
+	c.VAD.MinSilence = 100
+	c.VAD.SpeechPad = 30
+
+	c.Whisper.Model = "./whisper/ggml.bin"
+	c.Whisper.Contexts = 2
+	c.Whisper.Sampling = "greedy"
+	c.Whisper.BeamSize = 5
+	c.Whisper.PoolTimeout = 10000
+
+	c.WhisperAPI.BaseURL = "https://api.openai.com/v1"
+	c.WhisperAPI.Model = "whisper-1"
+	c.WhisperAPI.Timeout = 10000
+	c.WhisperAPI.Retries = 2
+
+	c.Knowledge.Enable = true
+	c.Knowledge.Provider = "houndify"
+	c.Knowledge.Timeout = int(KnowledgeTimeout / time.Millisecond)
+
+	c.Weather.Enable = true
+	c.Weather.Provider = "weatherapi.com"
+	c.Blacklist.ESNs = []string{}
+
+	c.Quotas.Path = QuotaConfigPath
+	c.Recording.Path = RecordingsPath
+	c.Recording.RetentionDays = int(RecordingRetention / (24 * time.Hour))
+	c.Recording.MaxMB = RecordingMaxBytes >> 20
+	c.Cache.RobotSettings = RobotSettingsCacheSize
+	c.Cache.ConnectionCheckHistory = ConnectionCheckHistoryLimit
+
+	c.Logging.Level = LogLevel
+	c.Logging.Format = LogFormat
+	c.Tracing.ServiceName = TracingServiceName
+	c.Tracing.SampleRatio = TracingSampleRatio
+	c.Dev.Hosts = []string{}
+	c.LAN.Hostname = "escapepod"
+	c.LAN.Household = "household@escapepod.local"
+	return c
+}
+
+// DefaultConfigJSON is the default config as written in cavalier.example.json
+func DefaultConfigJSON() ([]byte, error) {
+	return json.MarshalIndent(defaults, "", "    ")
+}
+
+func setString(field func(c *APIConfig) *string) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		*field(c) = val
+		return nil
+	}
+}
+
+func setInt(field func(c *APIConfig) *int) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return errors.New("not a whole number")
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func setInt64(field func(c *APIConfig) *int64) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return errors.New("not a whole number")
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func setFloat(field func(c *APIConfig) *float64) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+// comma separated, empty for none
+func setList(field func(c *APIConfig) *[]string) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		list := []string{}
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setBool(field func(c *APIConfig) *bool) func(c *APIConfig, val string) error {
+	return func(c *APIConfig, val string) error {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return errors.New("not true or false")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// environment variables that override a field of the file when set and non-empty
+var envOverrides = []struct {
+	env string
+	set func(c *APIConfig, val string) error
+}{
+	{ChipperAddrEnv, setString(func(c *APIConfig) *string { return &c.Server.ChipperAddr })},
+	{AccountsAddrEnv, setString(func(c *APIConfig) *string { return &c.Server.AccountsAddr })},
+	{AccountsTLSAddrEnv, setString(func(c *APIConfig) *string { return &c.Server.AccountsTLSAddr })},
+	{CertEnv, setString(func(c *APIConfig) *string { return &c.Server.Cert })},
+	{KeyEnv, setString(func(c *APIConfig) *string { return &c.Server.Key })},
+	{CAEnv, setString(func(c *APIConfig) *string { return &c.Server.CA })},
+	{PublicHostEnv, setString(func(c *APIConfig) *string { return &c.Server.PublicHost })},
+	{AdminKeyEnv, setString(func(c *APIConfig) *string { return &c.Server.AdminKey })},
+	{MetricsAddrEnv, setString(func(c *APIConfig) *string { return &c.Server.MetricsAddr })},
+	{ShutdownTimeoutEnv, setInt(func(c *APIConfig) *int { return &c.Server.ShutdownTimeout })},
+
+	{UserDBEnv, setString(func(c *APIConfig) *string { return &c.Database.UserDB })},
+	{JdocsDBEnv, setString(func(c *APIConfig) *string { return &c.Database.JdocsDB })},
+	{SessionCertEnv, setString(func(c *APIConfig) *string { return &c.Database.SessionCerts })},
+
+	{STTServiceEnv, setString(func(c *APIConfig) *string { return &c.STT.Service })},
+	{STTLanguageEnv, setString(func(c *APIConfig) *string { return &c.STT.Language })},
+	{STTLanguagesEnv, setList(func(c *APIConfig) *[]string { return &c.STT.Languages })},
+	{VoskGrammerEnv, setBool(func(c *APIConfig) *bool { return &c.STT.VoskGrammer })},
+	{MaxUtteranceEnv, setInt(func(c *APIConfig) *int { return &c.STT.MaxUtterance })},
+	{StreamIdleEnv, setInt(func(c *APIConfig) *int { return &c.STT.StreamIdle })},
+
+	{WhisperModelEnv, setString(func(c *APIConfig) *string { return &c.Whisper.Model })},
+	{WhisperContextsEnv, setInt(func(c *APIConfig) *int { return &c.Whisper.Contexts })},
+	{WhisperThreadsEnv, setInt(func(c *APIConfig) *int { return &c.Whisper.Threads })},
+
+	{WhisperAPIURLEnv, setString(func(c *APIConfig) *string { return &c.WhisperAPI.BaseURL })},
+	{WhisperAPIKeyEnv, setString(func(c *APIConfig) *string { return &c.WhisperAPI.Key })},
+	{WhisperAPIModelEnv, setString(func(c *APIConfig) *string { return &c.WhisperAPI.Model })},
+
+	{HoundKeyEnv, setString(func(c *APIConfig) *string { return &c.Knowledge.Key })},
+	{HoundIDEnv, setString(func(c *APIConfig) *string { return &c.Knowledge.ID })},
+	{KnowledgeTimeoutEnv, setInt(func(c *APIConfig) *int { return &c.Knowledge.Timeout })},
+	{WeatherKeyEnv, setString(func(c *APIConfig) *string { return &c.Weather.Key })},
+
+	{RecordingRetentionEnv, setInt(func(c *APIConfig) *int { return &c.Recording.RetentionDays })},
+	{RecordingMaxMBEnv, setInt64(func(c *APIConfig) *int64 { return &c.Recording.MaxMB })},
+
+	{LogLevelEnv, setString(func(c *APIConfig) *string { return &c.Logging.Level })},
+	{LogFormatEnv, setString(func(c *APIConfig) *string { return &c.Logging.Format })},
+
+	{TracingEndpointEnv, setString(func(c *APIConfig) *string { return &c.Tracing.Endpoint })},
+	{TracingServiceNameEnv, setString(func(c *APIConfig) *string { return &c.Tracing.ServiceName })},
+	{TracingSampleRatioEnv, setFloat(func(c *APIConfig) *float64 { return &c.Tracing.SampleRatio })},
+
+	{DevModeEnv, setBool(func(c *APIConfig) *bool { return &c.Dev.Enable })},
+
+	{LANModeEnv, setBool(func(c *APIConfig) *bool { return &c.Server.EPConfig })},
+	{LANHostnameEnv, setString(func(c *APIConfig) *string { return &c.LAN.Hostname })},
+	{LANHouseholdEnv, setString(func(c *APIConfig) *string { return &c.LAN.Household })},
+}
+
+// LoadConfig reads the config file over the defaults, applies the environment and validates the result.
+// it doesn't change the running config, see Init
+func LoadConfig() (APIConfig, string, []string, error) {
+	c := defaults
+	var warnings []string
+
+	path := ConfigPath
+	explicit := false
+	if env := os.Getenv(ConfigPathEnv); env != "" {
+		path = env
+		explicit = true
+	}
+	source := path
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return c, source, warnings, errors.New("LoadConfig: failed to parse " + path + ": " + err.Error())
+		}
+	case !os.IsNotExist(err) || explicit:
+		return c, source, warnings, errors.New("LoadConfig: failed to read " + path + ": " + err.Error())
+	default:
+		source = "defaults"
+		// older setups only had the blacklist file, which had the same layout
+		if data, err := os.ReadFile("./blacklist.json"); err == nil {
+			if err := json.Unmarshal(data, &c); err != nil {
+				return c, source, warnings, errors.New("LoadConfig: failed to parse ./blacklist.json: " + err.Error())
+			}
+			source = "./blacklist.json"
+			warnings = append(warnings, "blacklist.json is deprecated and all of its settings now apply, move them to "+path)
+		}
+	}
+
+	var problems []string
+	for _, o := range envOverrides {
+		val := os.Getenv(o.env)
+		if val == "" {
+			continue
+		}
+		if err := o.set(&c, val); err != nil {
+			problems = append(problems, o.env+": "+err.Error()+" ("+val+")")
+		}
+	}
+	problems = append(problems, validateConfig(c)...)
+	if c.Knowledge.Enable && (c.Knowledge.Key == "" || c.Knowledge.ID == "") {
+		warnings = append(warnings, "knowledge is enabled but the Houndify key or ID is empty, knowledge graph requests won't be answered")
+	}
+	if len(problems) > 0 {
+		return c, source, warnings, errors.New("LoadConfig: invalid config from " + source + ":\n  " + strings.Join(problems, "\n  "))
+	}
+	return c, source, warnings, nil
+}
+
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	p, err := strconv.Atoi(port)
+	return err == nil && p >= 0 && p <= 65535
+}
+
+func oneOf(val string, options ...string) bool {
+	for _, o := range options {
+		if val == o {
+			return true
+		}
+	}
+	return false
+}
+
+// one part of a hostname, like the escapepod in escapepod.local
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// every problem with the config, named by the JSON field
+func validateConfig(c APIConfig) []string {
+	var problems []string
+	bad := func(field, problem string) {
+		problems = append(problems, field+": "+problem)
+	}
+
+	if !validAddr(c.Server.ChipperAddr) {
+		bad("server.chipper_addr", "must be host:port or :port")
+	}
+	if c.Server.AccountsAddr == "" && c.Server.AccountsTLSAddr == "" {
+		bad("server.accounts_addr", "set it or server.accounts_tls_addr, the accounts API needs a listener")
+	}
+	if c.Server.AccountsAddr != "" && !validAddr(c.Server.AccountsAddr) {
+		bad("server.accounts_addr", "must be host:port, :port or empty")
+	}
+	if c.Server.AccountsTLSAddr != "" && !validAddr(c.Server.AccountsTLSAddr) {
+		bad("server.accounts_tls_addr", "must be host:port, :port or empty")
+	}
+	if c.Server.MetricsAddr != "" && !validAddr(c.Server.MetricsAddr) {
+		bad("server.metrics_addr", "must be host:port, :port or empty")
+	}
+	if c.Server.CA != "" {
+		if _, err := os.Stat(c.Server.CA); err != nil {
+			bad("server.ca", err.Error())
+		}
+	}
+	if host := c.Server.PublicHost; host != "" && net.ParseIP(host) == nil && (strings.ContainsAny(host, " /:") || strings.HasPrefix(host, "*")) {
+		bad("server.public_host", "must be a hostname or IP address, without a scheme or port")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		bad("server.shutdown_timeout_ms", "must be above 0")
+	}
+
+	if c.Database.UserDB == "" {
+		bad("database.user_db", "must be set")
+	}
+	if c.Database.JdocsDB == "" {
+		bad("database.jdocs_db", "must be set")
+	}
+	if c.Database.UserDB != "" && c.Database.UserDB == c.Database.JdocsDB {
+		bad("database.jdocs_db", "must be a different file from database.user_db")
+	}
+	if c.Database.SessionCerts == "" {
+		bad("database.session_certs", "must be set")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		bad("database.max_open_conns", "must be at least 1")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		bad("database.max_idle_conns", "can't be negative")
+	}
+	if c.Database.ConnMaxIdle < 0 {
+		bad("database.conn_max_idle_ms", "can't be negative")
+	}
+	if c.Database.BusyTimeout < 0 {
+		bad("database.busy_timeout_ms", "can't be negative")
+	}
+	if !oneOf(c.Database.Synchronous, "OFF", "NORMAL", "FULL", "EXTRA") {
+		bad("database.synchronous", "must be OFF, NORMAL, FULL or EXTRA")
+	}
+
+	if c.STT.Language == "" {
+		bad("STT.language", "must be set")
+	} else if _, err := os.Stat("./intent-data/" + c.STT.Language + ".json"); err != nil {
+		bad("STT.language", "no intents for "+c.STT.Language+" (intent-data/"+c.STT.Language+".json)")
+	}
+	for _, language := range c.STT.Languages {
+		if _, err := os.Stat("./intent-data/" + language + ".json"); language == "" || err != nil {
+			bad("STT.languages", "no intents for \""+language+"\" (intent-data/"+language+".json)")
+		}
+	}
+	if c.STT.MaxUtterance <= 0 {
+		bad("STT.max_utterance_ms", "must be above 0")
+	}
+	if c.STT.StreamIdle <= 0 {
+		bad("STT.stream_idle_ms", "must be above 0")
+	}
+
+	if c.VAD.SpeechThreshold <= 0 || c.VAD.SpeechThreshold >= 1 {
+		bad("vad.speech_threshold", "must be between 0 and 1")
+	}
+	if c.VAD.MinSilence <= 0 {
+		bad("vad.min_silence_ms", "must be above 0")
+	}
+	if c.VAD.SpeechPad < 0 {
+		bad("vad.speech_pad_ms", "can't be negative")
+	}
+
+	if c.Whisper.Model == "" {
+		bad("whisper.model", "must be set")
+	}
+	if c.Whisper.Contexts < 1 {
+		bad("whisper.contexts", "must be at least 1")
+	}
+	if c.Whisper.Threads < 0 {
+		bad("whisper.threads", "can't be negative")
+	}
+	if !oneOf(c.Whisper.Sampling, "greedy", "beam_search") {
+		bad("whisper.sampling", "must be greedy or beam_search")
+	}
+	if c.Whisper.BeamSize < 1 {
+		bad("whisper.beam_size", "must be at least 1")
+	}
+	if c.Whisper.PoolTimeout <= 0 {
+		bad("whisper.pool_timeout_ms", "must be above 0")
+	}
+
+	if u, err := url.Parse(c.WhisperAPI.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		bad("whisper_api.base_url", "must be an http or https URL")
+	}
+	if c.WhisperAPI.Model == "" {
+		bad("whisper_api.model", "must be set")
+	}
+	if c.WhisperAPI.Timeout <= 0 {
+		bad("whisper_api.timeout_ms", "must be above 0")
+	}
+	if c.WhisperAPI.Retries < 0 {
+		bad("whisper_api.retries", "can't be negative")
+	}
+
+	if c.Knowledge.Enable && c.Knowledge.Provider != "houndify" {
+		bad("knowledge.provider", "only houndify is supported")
+	}
+	if c.Knowledge.Timeout <= 0 {
+		bad("knowledge.timeout_ms", "must be above 0")
+	}
+	if c.Weather.Enable && !oneOf(c.Weather.Provider, "weatherapi.com", "openweathermap.org") {
+		bad("weather.provider", "must be weatherapi.com or openweathermap.org")
+	}
+	if !oneOf(c.Weather.Unit, "", "F", "C") {
+		bad("weather.unit", "must be F, C or empty")
+	}
+
+	if c.Quotas.Path == "" {
+		bad("quotas.path", "must be set")
+	}
+	if c.Recording.Path == "" {
+		bad("recording.path", "must be set")
+	}
+	if c.Recording.RetentionDays < 0 {
+		bad("recording.retention_days", "can't be negative")
+	}
+	if c.Recording.MaxMB < 0 {
+		bad("recording.max_mb", "can't be negative")
+	}
+	if c.Cache.RobotSettings < 1 {
+		bad("cache.robot_settings", "must be at least 1")
+	}
+	if c.Cache.ConnectionCheckHistory < 1 {
+		bad("cache.connection_check_history", "must be at least 1")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		bad("logging.level", "must be debug, info, warn or error")
+	}
+	if !oneOf(c.Logging.Format, "json", "text") {
+		bad("logging.format", "must be json or text")
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad("tracing.endpoint", "must be an http(s) URL")
+		}
+	}
+	if c.Tracing.ServiceName == "" {
+		bad("tracing.service_name", "must be set")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		bad("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	// dev mode makes its own certificate, and isn't for serving real robots
+	if c.Dev.Enable {
+		if c.Server.Cert != "" || c.Server.Key != "" || c.Server.CA != "" {
+			bad("dev.enable", "can't be used with server.cert, server.key or server.ca ("+CertEnv+", "+KeyEnv+", "+CAEnv+"), dev mode makes its own certificate")
+		}
+		if c.Server.EPConfig {
+			bad("dev.enable", "can't be used with server.epconfig")
+		}
+	}
+	for _, host := range c.Dev.Hosts {
+		if host == "" || strings.ContainsAny(host, " /:") && net.ParseIP(host) == nil {
+			bad("dev.hosts", "\""+host+"\" isn't a hostname or IP address")
+		}
+	}
+
+	if c.Server.EPConfig {
+		if !validLabel(c.LAN.Hostname) {
+			bad("lan.hostname", "must be a single DNS label (letters, digits and -), without .local")
+		}
+		if !strings.Contains(c.LAN.Household, "@") {
+			bad("lan.household", "must be an email address")
+		}
+	}
+	return problems
+}
+
+// makes c the running config
+func applyConfig(c APIConfig, source string, warnings []string) {
+	reloadMu.Lock()
+	publish(func(s *snapshot) {
+		s.config = &c
+		s.source = source
+		s.warnings = warnings
+	})
+	reloadMu.Unlock()
+
+	ChipperAddr = c.Server.ChipperAddr
+	AccountsAddr = c.Server.AccountsAddr
+	AccountsTLSAddr = c.Server.AccountsTLSAddr
+	CertPath = c.Server.Cert
+	KeyPath = c.Server.Key
+	CAPath = c.Server.CA
+	PublicHost = c.Server.PublicHost
+	AdminKey = c.Server.AdminKey
+	MetricsAddr = c.Server.MetricsAddr
+	ShutdownTimeout = time.Duration(c.Server.ShutdownTimeout) * time.Millisecond
+
+	UserDBPath = c.Database.UserDB
+	JdocsDBPath = c.Database.JdocsDB
+	SessionCertsStorage = c.Database.SessionCerts
+	DBMaxOpenConns = c.Database.MaxOpenConns
+	DBMaxIdleConns = c.Database.MaxIdleConns
+	DBConnMaxIdle = time.Duration(c.Database.ConnMaxIdle) * time.Millisecond
+	DBBusyTimeoutMs = c.Database.BusyTimeout
+	DBSynchronousOpt = c.Database.Synchronous
+
+	MaxUtteranceLength = time.Duration(c.STT.MaxUtterance) * time.Millisecond
+	StreamIdleTimeout = time.Duration(c.STT.StreamIdle) * time.Millisecond
+	KnowledgeTimeout = time.Duration(c.Knowledge.Timeout) * time.Millisecond
+
+	QuotaConfigPath = c.Quotas.Path
+	RecordingsPath = c.Recording.Path
+	RecordingRetention = time.Duration(c.Recording.RetentionDays) * 24 * time.Hour
+	RecordingMaxBytes = c.Recording.MaxMB << 20
+	RobotSettingsCacheSize = c.Cache.RobotSettings
+	ConnectionCheckHistoryLimit = c.Cache.ConnectionCheckHistory
+
+	LogLevel = c.Logging.Level
+	LogFormat = c.Logging.Format
+	TracingEndpoint = c.Tracing.Endpoint
+	TracingServiceName = c.Tracing.ServiceName
+	TracingSampleRatio = c.Tracing.SampleRatio
+}
+
+// Init loads the config and makes it the running one. nothing is changed if it's invalid.
+func Init() error {
+	c, source, warnings, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	applyConfig(c, source, warnings)
+	os.MkdirAll(SessionCertsStorage, 0777)
+	return nil
+}
+
+// LanguagesOf are the STT languages of c, the default first and without repeats
+func LanguagesOf(c *APIConfig) []string {
+	languages := []string{c.STT.Language}
+	for _, language := range c.STT.Languages {
+		if !slices.Contains(languages, language) {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// Languages are the STT languages loaded, the default first
+func Languages() []string {
+	return LanguagesOf(Config())
+}
@@ -0,0 +1,100 @@
+package vars
+
+import (
+	"errors"
+	"time"
+
+	"cavalier/pkg/metrics"
+)
+
+// results of chipper connection checks, kept per robot so owners can tell whether their wifi is the problem
+
+var ConnectionCheckHistoryLimit = 50
+
+type ConnectionCheckResult struct {
+	Thing          string    `json:"-"`
+	Time           time.Time `json:"time"`
+	Status         string    `json:"status"`
+	FramesExpected uint32    `json:"frames_expected"`
+	FramesReceived uint32    `json:"frames_received"`
+	// from the first frame to the last one (or the timeout)
+	DurationMs int64 `json:"duration_ms"`
+	// bytes of audio received per second
+	ThroughputBps float64 `json:"throughput_bps"`
+	// mean deviation of frame inter-arrival times from the interval the robot said it would send at
+	JitterMs float64 `json:"jitter_ms"`
+	MaxGapMs float64 `json:"max_gap_ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func initConnectionChecks() error {
+	_, err := JDOCSDB.Exec(`
+		CREATE TABLE IF NOT EXISTS connection_checks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			thing TEXT NOT NULL,
+			time INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			frames_expected INTEGER NOT NULL,
+			frames_received INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			throughput_bps REAL NOT NULL,
+			jitter_ms REAL NOT NULL,
+			max_gap_ms REAL NOT NULL,
+			error TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS connection_checks_thing ON connection_checks (thing, time);
+	`)
+	return err
+}
+
+// SaveConnectionCheck stores a result and drops everything past the newest ConnectionCheckHistoryLimit for that robot
+func SaveConnectionCheck(res ConnectionCheckResult) error {
+	defer metrics.ObserveDB("jdocs", "save_connection_check", time.Now())
+	tx, err := JDOCSDB.Begin()
+	if err != nil {
+		return errors.New("SaveConnectionCheck: " + err.Error())
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
+		"INSERT INTO connection_checks (thing, time, status, frames_expected, frames_received, duration_ms, throughput_bps, jitter_ms, max_gap_ms, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		res.Thing, res.Time.UnixMilli(), res.Status, res.FramesExpected, res.FramesReceived, res.DurationMs, res.ThroughputBps, res.JitterMs, res.MaxGapMs, res.Error,
+	)
+	if err != nil {
+		return errors.New("SaveConnectionCheck: failed to insert: " + err.Error())
+	}
+	_, err = tx.Exec(
+		"DELETE FROM connection_checks WHERE thing = ? AND id NOT IN (SELECT id FROM connection_checks WHERE thing = ? ORDER BY time DESC, id DESC LIMIT ?)",
+		res.Thing, res.Thing, ConnectionCheckHistoryLimit,
+	)
+	if err != nil {
+		return errors.New("SaveConnectionCheck: failed to prune: " + err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("SaveConnectionCheck: " + err.Error())
+	}
+	return nil
+}
+
+// GetConnectionChecks returns up to limit results for a thing, newest first
+func GetConnectionChecks(thing string, limit int) ([]ConnectionCheckResult, error) {
+	defer metrics.ObserveDB("jdocs", "get_connection_checks", time.Now())
+	rows, err := JDOCSDB.Query(
+		"SELECT time, status, frames_expected, frames_received, duration_ms, throughput_bps, jitter_ms, max_gap_ms, error FROM connection_checks WHERE thing = ? ORDER BY time DESC, id DESC LIMIT ?",
+		thing, limit,
+	)
+	if err != nil {
+		return nil, errors.New("GetConnectionChecks: " + err.Error())
+	}
+	defer rows.Close()
+	results := []ConnectionCheckResult{}
+	for rows.Next() {
+		res := ConnectionCheckResult{Thing: thing}
+		var ms int64
+		if err := rows.Scan(&ms, &res.Status, &res.FramesExpected, &res.FramesReceived, &res.DurationMs, &res.ThroughputBps, &res.JitterMs, &res.MaxGapMs, &res.Error); err != nil {
+			return nil, errors.New("GetConnectionChecks: " + err.Error())
+		}
+		res.Time = time.UnixMilli(ms).UTC()
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
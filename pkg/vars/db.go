@@ -0,0 +1,47 @@
+package vars
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite only allows one writer at a time. In WAL mode readers never block on it,
+// so the pool mostly exists for concurrent reads. Writers wait up to DBBusyTimeout for each other.
+var (
+	DBMaxOpenConns   = 8
+	DBMaxIdleConns   = 8
+	DBConnMaxIdle    = 5 * time.Minute
+	DBBusyTimeoutMs  = 5000
+	DBSynchronousOpt = "NORMAL"
+)
+
+// OpenDB opens a SQLite database in WAL mode with a busy timeout and a tuned connection pool.
+func OpenDB(path string) (*sql.DB, error) {
+	dsn := "file:" + path +
+		"?_journal_mode=WAL" +
+		"&_busy_timeout=" + strconv.Itoa(DBBusyTimeoutMs) +
+		"&_synchronous=" + DBSynchronousOpt
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(DBMaxOpenConns)
+	db.SetMaxIdleConns(DBMaxIdleConns)
+	db.SetConnMaxIdleTime(DBConnMaxIdle)
+
+	// sql.Open is lazy, make sure the file actually opens and WAL took effect
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		db.Close()
+		return nil, errors.New("OpenDB: failed to open " + path + ": " + err.Error())
+	}
+	if mode != "wal" {
+		db.Close()
+		return nil, errors.New("OpenDB: " + path + " is in " + mode + " mode, WAL could not be enabled")
+	}
+	return db, nil
+}
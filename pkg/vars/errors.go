@@ -13,6 +13,7 @@ const CodeBadDOB string = "bad_dob"
 const CodeTooManyRequests string = "too_many_requests"
 const CodeSessionCertNotFound string = "session_cert_not_found"
 const CodeSessionExpired string = "session_expired"
+const CodeDeviceBlacklisted string = "device_blacklisted"
 
 var ErrUserNotFound error = errors.New(CodeUserNotFound)
 var ErrUserAlreadyExists error = errors.New(CodeUserAlreadyExists)
@@ -24,3 +25,4 @@ var ErrBadEmail error = errors.New(CodeBadEmail)
 var ErrBadDOB error = errors.New(CodeBadDOB)
 var ErrSessionCertNotFound error = errors.New(CodeSessionCertNotFound)
 var ErrSessionExpired error = errors.New(CodeSessionExpired)
+var ErrDeviceBlacklisted error = errors.New(CodeDeviceBlacklisted)
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
+
+	"cavalier/pkg/metrics"
 
 	"github.com/digital-dream-labs/api/go/jdocspb"
 )
@@ -27,6 +30,9 @@ func InitJdocsDB(jdocsDB *sql.DB) {
 		panic("failed to initialize bot_jdocs table: " + err.Error())
 	}
 	JDOCSDB = jdocsDB
+	if err := initConnectionChecks(); err != nil {
+		panic("failed to initialize connection_checks table: " + err.Error())
+	}
 }
 
 func AJdocToJdoc(in AJdoc) jdocspb.Jdoc {
@@ -63,6 +69,7 @@ func Thingifier(esn string) string {
 }
 
 func WriteJdoc(thing string, name string, jdoc AJdoc) error {
+	defer metrics.ObserveDB("jdocs", "write_jdoc", time.Now())
 	_, err := JDOCSDB.Exec(
 		"INSERT OR REPLACE INTO bot_jdocs (thing, name, doc_version, fmt_version, client_metadata, json_doc) VALUES (?, ?, ?, ?, ?, ?)",
 		thing, name, jdoc.DocVersion, jdoc.FmtVersion, jdoc.ClientMetadata, jdoc.JsonDoc,
@@ -70,10 +77,14 @@ func WriteJdoc(thing string, name string, jdoc AJdoc) error {
 	if err != nil {
 		return errors.New("WriteJdoc: failed to write jdoc: " + err.Error())
 	}
+	if name == RobotSettingsJdoc {
+		InvalidateRobotSettings(thing)
+	}
 	return nil
 }
 
 func ReadJdoc(thing string, name string) (AJdoc, error) {
+	defer metrics.ObserveDB("jdocs", "read_jdoc", time.Now())
 	var jdoc AJdoc
 	err := JDOCSDB.QueryRow(
 		"SELECT doc_version, fmt_version, client_metadata, json_doc FROM bot_jdocs WHERE thing = ? AND name = ?",
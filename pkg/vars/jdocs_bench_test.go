@@ -0,0 +1,68 @@
+package vars
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// jdoc throughput under concurrency, against a throwaway database opened the same way the
+// server opens it (WAL, busy timeout).
+//
+//	go test ./pkg/vars -run '^$' -bench Jdoc -cpu 1,4,16
+
+const benchSettings = `{"default_location":"San Francisco","temp_is_fahrenheit":true,"locale":"en-US"}`
+
+func benchJdocs(b *testing.B, n int) []string {
+	b.Helper()
+	db, err := OpenDB(filepath.Join(b.TempDir(), "bot_database.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	InitJdocsDB(db)
+	things := make([]string, n)
+	for i := range things {
+		things[i] = Thingifier(fmt.Sprintf("%08x", i))
+		if err := WriteJdoc(things[i], "vic.RobotSettings", AJdoc{DocVersion: 1, FmtVersion: 1, JsonDoc: benchSettings}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return things
+}
+
+func BenchmarkReadJdoc(b *testing.B) {
+	things := benchJdocs(b, 200)
+	var counter atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := ReadJdoc(things[counter.Add(1)%uint64(len(things))], "vic.RobotSettings"); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// one write for every ten reads, roughly what robots syncing settings while others talk looks like
+func BenchmarkReadWriteJdoc(b *testing.B) {
+	things := benchJdocs(b, 200)
+	var counter atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := counter.Add(1)
+			thing := things[n%uint64(len(things))]
+			var err error
+			if n%10 == 0 {
+				err = WriteJdoc(thing, "vic.RobotSettings", AJdoc{DocVersion: n, FmtVersion: 1, JsonDoc: benchSettings})
+			} else {
+				_, err = ReadJdoc(thing, "vic.RobotSettings")
+			}
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package vars
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// one reload at a time, and no UpdateConfig in the middle of one
+var reloadMu sync.Mutex
+
+type ReloadResult struct {
+	Source    string   `json:"source"`
+	Languages []string `json:"languages"`
+	// in the default language
+	Intents     int      `json:"intents"`
+	STTReloaded bool     `json:"stt_reloaded"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// settings only read at startup. a reload keeps the running values and says which ones changed
+func keepStartupSettings(c *APIConfig, running *APIConfig) []string {
+	var changed []string
+	if c.Server != running.Server {
+		changed = append(changed, "server")
+		c.Server = running.Server
+	}
+	if c.Database != running.Database {
+		changed = append(changed, "database")
+		c.Database = running.Database
+	}
+	if c.STT.MaxUtterance != running.STT.MaxUtterance || c.STT.StreamIdle != running.STT.StreamIdle {
+		changed = append(changed, "STT.max_utterance_ms and STT.stream_idle_ms")
+		c.STT.MaxUtterance = running.STT.MaxUtterance
+		c.STT.StreamIdle = running.STT.StreamIdle
+	}
+	if c.Knowledge.Timeout != running.Knowledge.Timeout {
+		changed = append(changed, "knowledge.timeout_ms")
+		c.Knowledge.Timeout = running.Knowledge.Timeout
+	}
+	if c.Quotas != running.Quotas {
+		changed = append(changed, "quotas")
+		c.Quotas = running.Quotas
+	}
+	if c.Recording != running.Recording {
+		changed = append(changed, "recording")
+		c.Recording = running.Recording
+	}
+	if c.Cache != running.Cache {
+		changed = append(changed, "cache")
+		c.Cache = running.Cache
+	}
+	if c.Logging != running.Logging {
+		changed = append(changed, "logging")
+		c.Logging = running.Logging
+	}
+	if c.Tracing != running.Tracing {
+		changed = append(changed, "tracing")
+		c.Tracing = running.Tracing
+	}
+	if c.Dev.Enable != running.Dev.Enable || !slices.Equal(c.Dev.Hosts, running.Dev.Hosts) {
+		changed = append(changed, "dev")
+		c.Dev = running.Dev
+	}
+	if c.LAN != running.LAN {
+		changed = append(changed, "lan")
+		c.LAN = running.LAN
+	}
+	return changed
+}
+
+// Reload re-reads the config (blacklist included) and the intent lists and swaps them in. the STT
+// models are only reloaded if the languages or their settings changed. if anything fails, the running
+// config, intents and model are all kept and the error is returned.
+func Reload() (ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	running := Config()
+
+	c, source, warnings, err := LoadConfig()
+	if err != nil {
+		return ReloadResult{}, errors.New("Reload: " + err.Error())
+	}
+	// the engine is built in, it can't change
+	if c.STT.Service == "" {
+		c.STT.Service = running.STT.Service
+	} else if c.STT.Service != running.STT.Service {
+		return ReloadResult{}, errors.New("Reload: STT.provider can't change from " + running.STT.Service + " without a restart")
+	}
+	for _, section := range keepStartupSettings(&c, running) {
+		warnings = append(warnings, "restart to apply the changes to "+section)
+	}
+	languages := LanguagesOf(&c)
+	intents, err := LoadAllIntents(languages)
+	if err != nil {
+		return ReloadResult{}, errors.New("Reload: failed to load intents: " + err.Error())
+	}
+
+	result := ReloadResult{Source: source, Languages: languages, Intents: len(intents[c.STT.Language]), Warnings: warnings}
+	if !slices.Equal(languages, LanguagesOf(running)) || c.STT.VoskGrammer != running.STT.VoskGrammer ||
+		c.Whisper != running.Whisper {
+		// the engine gets the new config before anyone else sees it. it only swaps its model in
+		// once the new one has loaded, so on failure the old one is still there
+		slog.Info("reloading stt", "engine", c.STT.Service, "languages", languages)
+		if err := SttInitFunc(&c); err != nil {
+			return ReloadResult{}, errors.New("Reload: failed to reload " + c.STT.Service + ": " + err.Error())
+		}
+		result.STTReloaded = true
+	}
+	// the config and the intents for its languages go out in one swap
+	publish(func(s *snapshot) {
+		s.config = &c
+		s.intents = intents
+		s.source = source
+		s.warnings = warnings
+	})
+
+	slog.Info("config reloaded", "source", source, "languages", languages, "stt_reloaded", result.STTReloaded,
+		"blacklisted", len(c.Blacklist.ESNs))
+	for _, warning := range warnings {
+		slog.Warn(warning)
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package vars
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// vic.RobotSettings is read on every matched voice intent (for location and units),
+// so parsed copies are kept in a small LRU. WriteJdoc drops the entry when the jdoc changes.
+
+const RobotSettingsJdoc = "vic.RobotSettings"
+
+var RobotSettingsCacheSize = 1024
+
+type RobotSettings struct {
+	ButtonWakeword int  `json:"button_wakeword"`
+	Clock24Hour    bool `json:"clock_24_hour"`
+	CustomEyeColor struct {
+		Enabled    bool    `json:"enabled"`
+		Hue        float64 `json:"hue"`
+		Saturation float64 `json:"saturation"`
+	} `json:"custom_eye_color"`
+	DefaultLocation  string `json:"default_location"`
+	DistIsMetric     bool   `json:"dist_is_metric"`
+	EyeColor         int    `json:"eye_color"`
+	Locale           string `json:"locale"`
+	MasterVolume     int    `json:"master_volume"`
+	TempIsFahrenheit bool   `json:"temp_is_fahrenheit"`
+	TimeZone         string `json:"time_zone"`
+}
+
+type settingsEntry struct {
+	thing    string
+	settings RobotSettings
+	// a robot without the jdoc is cached too, WriteJdoc invalidates it once one shows up
+	err error
+}
+
+type RobotSettingsCacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+var settingsCache = struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// bumped on every invalidation, so a read that raced a write doesn't cache the old jdoc
+	generation uint64
+}{
+	entries: make(map[string]*list.Element),
+	order:   list.New(),
+}
+
+var settingsHits uint64
+var settingsMisses uint64
+
+func readRobotSettings(thing string) (RobotSettings, error) {
+	var settings RobotSettings
+	jdoc, err := ReadJdoc(thing, RobotSettingsJdoc)
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal([]byte(jdoc.JsonDoc), &settings); err != nil {
+		return settings, errors.New("GetRobotSettings: failed to parse " + RobotSettingsJdoc + ": " + err.Error())
+	}
+	return settings, nil
+}
+
+// GetRobotSettings returns the parsed vic.RobotSettings jdoc for a thing ("vic:<esn>")
+func GetRobotSettings(thing string) (RobotSettings, error) {
+	settingsCache.mu.Lock()
+	if elem, ok := settingsCache.entries[thing]; ok {
+		settingsCache.order.MoveToFront(elem)
+		entry := elem.Value.(*settingsEntry)
+		settingsCache.mu.Unlock()
+		atomic.AddUint64(&settingsHits, 1)
+		return entry.settings, entry.err
+	}
+	generation := settingsCache.generation
+	settingsCache.mu.Unlock()
+	atomic.AddUint64(&settingsMisses, 1)
+
+	settings, err := readRobotSettings(thing)
+	if err != nil && err != ErrUserNotFound {
+		// don't cache db or parse errors, they might go away
+		return settings, err
+	}
+
+	settingsCache.mu.Lock()
+	defer settingsCache.mu.Unlock()
+	if generation != settingsCache.generation {
+		return settings, err
+	}
+	if elem, ok := settingsCache.entries[thing]; ok {
+		// someone else filled it in while we were reading
+		settingsCache.order.MoveToFront(elem)
+		return settings, err
+	}
+	settingsCache.entries[thing] = settingsCache.order.PushFront(&settingsEntry{thing: thing, settings: settings, err: err})
+	for settingsCache.order.Len() > RobotSettingsCacheSize {
+		oldest := settingsCache.order.Back()
+		settingsCache.order.Remove(oldest)
+		delete(settingsCache.entries, oldest.Value.(*settingsEntry).thing)
+	}
+	return settings, err
+}
+
+// InvalidateRobotSettings drops the cached settings for a thing
+func InvalidateRobotSettings(thing string) {
+	settingsCache.mu.Lock()
+	defer settingsCache.mu.Unlock()
+	settingsCache.generation++
+	if elem, ok := settingsCache.entries[thing]; ok {
+		settingsCache.order.Remove(elem)
+		delete(settingsCache.entries, thing)
+	}
+}
+
+func GetRobotSettingsCacheStats() RobotSettingsCacheStats {
+	settingsCache.mu.Lock()
+	size := settingsCache.order.Len()
+	settingsCache.mu.Unlock()
+	return RobotSettingsCacheStats{
+		Hits:     atomic.LoadUint64(&settingsHits),
+		Misses:   atomic.LoadUint64(&settingsMisses),
+		Size:     size,
+		Capacity: RobotSettingsCacheSize,
+	}
+}
@@ -3,73 +3,160 @@ package vars
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"strings"
+	"time"
 )
 
+// environment variables override the config file, see config.go
 var (
+	ConfigPathEnv = "CAVALIER_CONFIG"
+
+	ChipperAddrEnv     = "CHIPPER_ADDR"
+	AccountsAddrEnv    = "ACCOUNTS_ADDR"
+	AccountsTLSAddrEnv = "ACCOUNTS_TLS_ADDR"
+	KeyEnv             = "KEY"
+	CertEnv            = "CERT"
+	CAEnv              = "CA_CERT"
+	PublicHostEnv      = "PUBLIC_HOST"
+	AdminKeyEnv        = "ADMIN_KEY"
+	MetricsAddrEnv     = "METRICS_ADDR"
+
+	UserDBEnv      = "USER_DB"
+	JdocsDBEnv     = "JDOCS_DB"
 	SessionCertEnv = "SESSION_CERT_STORAGE"
-	HoundKeyEnv    = "HOUND_KEY"
-	HoundIDEnv     = "HOUND_ID"
-	WeatherKeyEnv  = "WEATHER_KEY"
-	KeyEnv         = "KEY"
-	CertEnv        = "CERT"
+
+	STTServiceEnv   = "STT_SERVICE"
+	STTLanguageEnv  = "STT_LANGUAGE"
+	STTLanguagesEnv = "STT_LANGUAGES"
+	VoskGrammerEnv  = "VOSK_WITH_GRAMMER"
+
+	WhisperModelEnv    = "WHISPER_MODEL"
+	WhisperContextsEnv = "WHISPER_CONTEXTS"
+	WhisperThreadsEnv  = "WHISPER_THREADS"
+
+	WhisperAPIURLEnv   = "WHISPER_API_URL"
+	WhisperAPIKeyEnv   = "WHISPER_API_KEY"
+	WhisperAPIModelEnv = "WHISPER_API_MODEL"
+
+	HoundKeyEnv   = "HOUND_KEY"
+	HoundIDEnv    = "HOUND_ID"
+	WeatherKeyEnv = "WEATHER_KEY"
+
+	MaxUtteranceEnv     = "MAX_UTTERANCE_MS"
+	StreamIdleEnv       = "STREAM_IDLE_MS"
+	KnowledgeTimeoutEnv = "KNOWLEDGE_TIMEOUT_MS"
+
+	RecordingRetentionEnv = "RECORDING_RETENTION_DAYS"
+	RecordingMaxMBEnv     = "RECORDING_MAX_MB"
+
+	LogLevelEnv  = "LOG_LEVEL"
+	LogFormatEnv = "LOG_FORMAT"
+
+	ShutdownTimeoutEnv = "SHUTDOWN_TIMEOUT_MS"
+
+	TracingEndpointEnv    = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	TracingServiceNameEnv = "OTEL_SERVICE_NAME"
+	TracingSampleRatioEnv = "OTEL_TRACES_SAMPLER_ARG"
+
+	DevModeEnv = "DEV_MODE"
+
+	LANModeEnv      = "LAN_MODE"
+	LANHostnameEnv  = "LAN_HOSTNAME"
+	LANHouseholdEnv = "LAN_HOUSEHOLD"
 )
 
+// the values below are the defaults. Init replaces them with the loaded config.
+
+var ConfigPath = "./cavalier.json"
+
+var ChipperAddr = ":8081"
+
+// plain HTTP and HTTPS listeners for the accounts API. either can be turned off with an empty address
+var AccountsAddr = ":8080"
+var AccountsTLSAddr string
+
 var CertPath string
 var KeyPath string
 
+// the CA robots are given to trust in server config bundles. empty means the top of the served chain
+var CAPath string
+
+// the name robots reach cavalier on. empty means work it out, see the accounts server config bundle
+var PublicHost string
+
+// AdminKey protects the /admin/ endpoints. If empty, the admin API is disabled.
+var AdminKey string
+
+// a plain HTTP listener for /metrics alone, for a scraper on a private network. empty serves
+// /metrics on the accounts listeners, behind the admin key
+var MetricsAddr string
+
 var SessionCertsStorage = "./session-certs"
 
+var UserDBPath = "./user_database.db"
+var JdocsDBPath = "./bot_database.db"
+
+// per-robot and global limits for the gRPC services, see quota.DefaultPolicies
+var QuotaConfigPath = "./quotas.json"
+
+// recordings of opted-in robots' voice requests. older ones are dropped past the retention,
+// and the oldest ones once the directory is over the cap. a cap of 0 turns recording off.
+var RecordingsPath = "./recordings"
+var RecordingRetention = 30 * 24 * time.Hour
+var RecordingMaxBytes int64 = 1 << 30
+
 var IDLength = 23
 
-var APIConfig apiConfig
-
-type apiConfig struct {
-	Weather struct {
-		Enable   bool   `json:"enable"`
-		Provider string `json:"provider"`
-		Key      string `json:"key"`
-		Unit     string `json:"unit"`
-	} `json:"weather"`
-	Knowledge struct {
-		Enable                 bool   `json:"enable"`
-		Provider               string `json:"provider"`
-		Key                    string `json:"key"`
-		ID                     string `json:"id"`
-		Model                  string `json:"model"`
-		IntentGraph            bool   `json:"intentgraph"`
-		RobotName              string `json:"robotName"`
-		OpenAIPrompt           string `json:"openai_prompt"`
-		OpenAIVoice            string `json:"openai_voice"`
-		OpenAIVoiceWithEnglish bool   `json:"openai_voice_with_english"`
-		SaveChat               bool   `json:"save_chat"`
-		CommandsEnable         bool   `json:"commands_enable"`
-		Endpoint               string `json:"endpoint"`
-	} `json:"knowledge"`
-	STT struct {
-		Service  string `json:"provider"`
-		Language string `json:"language"`
-	} `json:"STT"`
-	Server struct {
-		// false for ip, true for escape pod
-		EPConfig bool   `json:"epconfig"`
-		Port     string `json:"port"`
-	} `json:"server"`
-	Blacklist struct {
-		Enable        bool     `json:"enable"`
-		EnableStealth bool     `json:"enableStealth"`
-		ESNs          []string `json:"esns"`
-	} `json:"blacklist"`
-	HasReadFromEnv   bool `json:"hasreadfromenv"`
-	PastInitialSetup bool `json:"pastinitialsetup"`
-}
+// debug, info, warn or error
+var LogLevel = "info"
+
+// json or text
+var LogFormat = "json"
+
+// OTLP/HTTP collector spans are sent to, e.g. http://localhost:4318. tracing is off if empty.
+var TracingEndpoint string
+var TracingServiceName = "cavalier"
+
+// fraction of new traces to keep, 0 to 1
+var TracingSampleRatio = 1.0
 
-var SttInitFunc func() error
+// limits for voice streams. a robot streaming noise would otherwise hold an STT recognizer forever
+var MaxUtteranceLength = 15 * time.Second
 
-var IntentList []JsonIntent
+// longest gap allowed between two audio chunks
+var StreamIdleTimeout = 3 * time.Second
+
+// how long Houndify gets to answer once the audio is in
+var KnowledgeTimeout = 10 * time.Second
+
+// how long in-flight requests get to finish on SIGTERM before they're cut off.
+// longer than a full utterance plus a Houndify answer
+var ShutdownTimeout = 30 * time.Second
+
+// loads the STT engine for a config that isn't published yet, so a reload can fail without
+// the new settings ever being seen
+var SttInitFunc func(c *APIConfig) error
+
+// Intents is the intent list for language, or the default language's if it isn't loaded. the
+// lists are published with the config, a reload swaps both at once
+func Intents(language string) []JsonIntent {
+	s := current.Load()
+	if intents, ok := s.intents[language]; ok {
+		return intents
+	}
+	return s.intents[s.config.STT.Language]
+}
+
+// SetIntents makes lists, by language, the running intent lists
+func SetIntents(lists map[string][]JsonIntent) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	publish(func(s *snapshot) { s.intents = lists })
+}
 
 type JsonIntent struct {
 	Name              string   `json:"name"`
@@ -78,14 +165,15 @@ type JsonIntent struct {
 }
 
 func IsESNBlacklisted(esn string) bool {
-	if !APIConfig.Blacklist.Enable {
+	blacklist := Config().Blacklist
+	if !blacklist.Enable {
 		return false
 	}
 
 	esn = strings.ToLower(strings.TrimSpace(esn))
 	esn = strings.TrimPrefix(esn, "vic:")
 
-	for _, blacklistedESN := range APIConfig.Blacklist.ESNs {
+	for _, blacklistedESN := range blacklist.ESNs {
 		blacklistedESN = strings.ToLower(strings.TrimSpace(blacklistedESN))
 		blacklistedESN = strings.TrimPrefix(blacklistedESN, "vic:")
 
@@ -98,17 +186,17 @@ func IsESNBlacklisted(esn string) bool {
 }
 
 func UseStealthBlacklist() bool {
-	if !APIConfig.Blacklist.EnableStealth {
+	if !Config().Blacklist.EnableStealth {
 		return false
 	}
 
 	return true
 }
 
-func LoadIntents() ([]JsonIntent, error) {
+func LoadIntents(language string) ([]JsonIntent, error) {
 	var path string
 	path = "./"
-	jsonFile, err := os.ReadFile(path + "intent-data/" + APIConfig.STT.Language + ".json")
+	jsonFile, err := os.ReadFile(path + "intent-data/" + language + ".json")
 
 	// var matches [][]string
 	// var intents []string
@@ -124,11 +212,24 @@ func LoadIntents() ([]JsonIntent, error) {
 		// 	intents = append(intents, element.Name)
 		// 	matches = append(matches, element.Keyphrases)
 		// }
-		// fmt.Println("Loaded " + strconv.Itoa(len(jsonIntents)) + " intents and " + strconv.Itoa(len(matches)) + " matches (language: " + APIConfig.STT.Language + ")")
+		// fmt.Println("Loaded " + strconv.Itoa(len(jsonIntents)) + " intents and " + strconv.Itoa(len(matches)) + " matches (language: " + language + ")")
 	}
 	return jsonIntents, err
 }
 
+// LoadAllIntents loads the intent list of every language, failing if any of them does
+func LoadAllIntents(languages []string) (map[string][]JsonIntent, error) {
+	lists := make(map[string][]JsonIntent, len(languages))
+	for _, language := range languages {
+		intents, err := LoadIntents(language)
+		if err != nil {
+			return nil, errors.New("LoadAllIntents: " + language + ": " + err.Error())
+		}
+		lists[language] = intents
+	}
+	return lists, nil
+}
+
 func GenerateID() string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ123456789"
 	result := make([]byte, IDLength)
@@ -141,43 +242,3 @@ func GenerateID() string {
 	}
 	return string(result)
 }
-
-func Init() {
-	KeyPath = os.Getenv("KEY")
-	CertPath = os.Getenv("CERT")
-	os.MkdirAll(SessionCertsStorage, 0777)
-
-	LoadConfig()
-
-	APIConfig.STT.Language = "en-US"
-	APIConfig.STT.Service = "vosk"
-	APIConfig.Knowledge.Enable = true
-	APIConfig.Knowledge.Provider = "houndify"
-	APIConfig.Knowledge.Key = os.Getenv(HoundKeyEnv)
-	APIConfig.Knowledge.ID = os.Getenv(HoundIDEnv)
-	APIConfig.Weather.Enable = true
-	APIConfig.Weather.Key = os.Getenv(WeatherKeyEnv)
-	APIConfig.Weather.Provider = "weatherapi.com"
-}
-
-func LoadConfig() {
-	configPath := "./blacklist.json"
-	if _, err := os.Stat(configPath); err == nil {
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			fmt.Println("Failed to read blacklist file:", err)
-			return
-		}
-
-		err = json.Unmarshal(data, &APIConfig)
-		if err != nil {
-			fmt.Println("Failed to parse blacklist file:", err)
-			return
-		}
-
-		fmt.Println("Loaded blacklist from blacklist.json")
-		if APIConfig.Blacklist.Enable {
-			fmt.Printf("Blacklist enabled with %d ESNs\n", len(APIConfig.Blacklist.ESNs))
-		}
-	}
-}
@@ -1,32 +1,54 @@
 package wirepod_vosk
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
 
+	"cavalier/pkg/health"
+	"cavalier/pkg/metrics"
+	"cavalier/pkg/shutdown"
 	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/tracing"
 	"cavalier/pkg/vars"
 
 	vosk "github.com/kercre123/vosk-api/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var GrammerEnable bool = false
 
 var Name string = "vosk"
 
-var model *vosk.VoskModel
 var recsmu sync.Mutex
 
-var grmRecs []ARec
-var gpRecs []ARec
+// a model and its recognizers, one per loaded language
+type langModel struct {
+	model   *vosk.VoskModel
+	grmRecs []*ARec
+	gpRecs  []*ARec
+}
+
+func (lm *langModel) recs() []*ARec {
+	return append(append([]*ARec(nil), lm.grmRecs...), lm.gpRecs...)
+}
 
-var modelLoaded bool
+// guarded by recsmu. a reload swaps in a new map, the requests still using the old models
+// hold on to their own ARec. requests in a language that isn't loaded use the default
+var models map[string]*langModel
+var defaultLanguage string
+
+// recognizers being reset after a request, Close waits for them
+var resets sync.WaitGroup
+var registerClose sync.Once
 
 type ARec struct {
 	InUse bool
@@ -35,85 +57,104 @@ type ARec struct {
 
 var Grammer string
 
-func Init() error {
-	if os.Getenv("VOSK_WITH_GRAMMER") == "true" {
-		fmt.Println("Initializing vosk with grammer optimizations")
-		GrammerEnable = true
+// Init loads a model for each configured language. on a reload, models whose language is still
+// configured are kept (unless the grammer setting changed), new ones are only swapped in once they
+// have all loaded, and the ones no longer needed are freed when their requests finish
+func Init(c *vars.APIConfig) error {
+	withGrammer := c.STT.VoskGrammer
+	if withGrammer {
+		slog.Info("initializing vosk with grammer optimizations")
 	}
 	vosk.SetLogLevel(-1)
-	if modelLoaded {
-		fmt.Println("A model was already loaded, freeing all recognizers and model")
-		for ind, _ := range grmRecs {
-			grmRecs[ind].Rec.Free()
+	languages := vars.LanguagesOf(c)
+
+	recsmu.Lock()
+	running, runningGrammer := models, GrammerEnable
+	recsmu.Unlock()
+	newModels := make(map[string]*langModel, len(languages))
+	for _, language := range languages {
+		if lm, ok := running[language]; ok && runningGrammer == withGrammer {
+			newModels[language] = lm
+			continue
 		}
-		for ind, _ := range gpRecs {
-			gpRecs[ind].Rec.Free()
+		lm, err := loadModel(language, withGrammer)
+		if err != nil {
+			for language, loaded := range newModels {
+				if running[language] != loaded {
+					freeRecs(loaded.model, loaded.recs())
+				}
+			}
+			return err
 		}
-		gpRecs = []ARec{}
-		grmRecs = []ARec{}
-		model.Free()
+		newModels[language] = lm
 	}
-	sttLanguage := vars.APIConfig.STT.Language
-	if len(sttLanguage) == 0 {
-		sttLanguage = "en-US"
+
+	recsmu.Lock()
+	models, defaultLanguage = newModels, languages[0]
+	GrammerEnable = withGrammer
+	recsmu.Unlock()
+	for language, lm := range running {
+		if newModels[language] != lm {
+			slog.Info("freeing the old vosk model once its requests finish", "language", language)
+			go freeWhenIdle(lm.model, lm.recs())
+		}
 	}
-	modelPath := filepath.Join("./vosk", sttLanguage, "model")
+	metrics.RegisterSTTPool(Name, poolSize, poolInUse)
+	health.Register("stt", ready)
+	registerClose.Do(func() { shutdown.Register("vosk", Close) })
+	slog.Info("vosk initiated successfully", "languages", languages)
+	runTest()
+	return nil
+}
+
+func loadModel(language string, withGrammer bool) (*langModel, error) {
+	modelPath := filepath.Join("./vosk", language, "model")
 	if _, err := os.Stat(modelPath); err != nil {
-		fmt.Println("Path does not exist: " + modelPath)
-		return err
+		slog.Error("vosk model path does not exist", "path", modelPath)
+		return nil, err
 	}
-	fmt.Println("Opening VOSK model (" + modelPath + ")")
+	slog.Info("opening vosk model", "path", modelPath)
 	aModel, err := vosk.NewModel(modelPath)
 	if err != nil {
-		log.Fatal(err)
-		return err
+		slog.Error("failed to open vosk model", "path", modelPath, "error", err)
+		return nil, err
 	}
-	model = aModel
 
 	numThreads := runtime.NumCPU()
-	fmt.Printf("Initializing %d VOSK recognizers for %d CPU threads\n", numThreads, numThreads)
-	if GrammerEnable {
+	slog.Info("initializing vosk recognizers", "language", language, "count", numThreads)
+	lm := &langModel{model: aModel}
+	if withGrammer {
 		for i := 0; i < numThreads; i++ {
 			grmRecognizer, err := vosk.NewRecognizerGrm(aModel, 16000.0, Grammer)
 			if err != nil {
-				log.Fatal(err)
+				slog.Error("failed to create vosk recognizer", "error", err)
+				freeRecs(aModel, lm.recs())
+				return nil, err
 			}
-			var grmrec ARec
-			grmrec.Rec = grmRecognizer
-			grmrec.InUse = false
-			grmRecs = append(grmRecs, grmrec)
-			fmt.Printf("Created grammer recognizer %d/%d\n", i+1, numThreads)
+			lm.grmRecs = append(lm.grmRecs, &ARec{Rec: grmRecognizer})
+			slog.Debug("created grammer recognizer", "n", i+1, "of", numThreads)
 		}
 	}
 	for i := 0; i < numThreads; i++ {
 		gpRecognizer, err := vosk.NewRecognizer(aModel, 16000.0)
 		if err != nil {
-			log.Fatal(err)
+			slog.Error("failed to create vosk recognizer", "error", err)
+			freeRecs(aModel, lm.recs())
+			return nil, err
 		}
-		var gprec ARec
-		gprec.Rec = gpRecognizer
-		gprec.InUse = false
-		gpRecs = append(gpRecs, gprec)
-		fmt.Printf("Created general recognizer %d/%d\n", i+1, numThreads)
-	}
-	modelLoaded = true
-	fmt.Println("VOSK initiated successfully")
-	runTest()
-	return nil
+		lm.gpRecs = append(lm.gpRecs, &ARec{Rec: gpRecognizer})
+		slog.Debug("created general recognizer", "n", i+1, "of", numThreads)
+	}
+	return lm, nil
 }
 
 func runTest() {
-	// make sure recognizer is all loaded into RAM
-	fmt.Println("Running recognizer test")
-	var withGrm bool
-	if GrammerEnable {
-		fmt.Println("Using grammer-optimized recognizer")
-		withGrm = true
-	} else {
-		fmt.Println("Using general recognizer")
-		withGrm = false
-	}
-	rec, recind := getRec(withGrm)
+	// make sure recognizer is all loaded into RAM. the test audio is English, so only the
+	// default language's model is tried
+	withGrm := grammerEnabled()
+	slog.Info("running vosk recognizer test", "grammer", withGrm)
+	arec := getRec("", withGrm)
+	rec := arec.Rec
 	sttTestPath := "./stttest.pcm"
 	pcmBytes, _ := os.ReadFile(sttTestPath)
 	var micData [][]byte
@@ -124,109 +165,226 @@ func runTest() {
 	}
 	var jres map[string]interface{}
 	json.Unmarshal([]byte(rec.FinalResult()), &jres)
-	if withGrm {
-		grmRecs[recind].InUse = false
-	} else {
-		gpRecs[recind].InUse = false
-	}
+	rec.Reset()
+	recsmu.Lock()
+	arec.InUse = false
+	recsmu.Unlock()
 	transcribedText := jres["text"].(string)
 	tTime := time.Now().Sub(cTime)
-	fmt.Println("Text (from test):", transcribedText)
 	if tTime.Seconds() > 3 {
-		fmt.Println("Vosk test took a while, performance may be degraded. (" + fmt.Sprint(tTime) + ")")
+		slog.Warn("vosk test took a while, performance may be degraded", "duration", tTime)
+	}
+	slog.Info("vosk test successful", "text", transcribedText, "duration", tTime)
+
+}
+
+// the model is loaded and there are recognizers. a busy pool is fine, getRec makes temporary ones
+func ready(ctx context.Context) error {
+	recsmu.Lock()
+	loaded := len(models) > 0
+	recsmu.Unlock()
+	if !loaded {
+		return errors.New("vosk model not loaded")
+	}
+	if poolSize() == 0 {
+		return errors.New("no vosk recognizers")
+	}
+	return nil
+}
+
+// Close frees the recognizers and model once no request is using them. if some still are when
+// ctx is done, nothing is freed, the process is about to exit anyway
+func Close(ctx context.Context) error {
+	for poolInUse() > 0 {
+		select {
+		case <-ctx.Done():
+			return errors.New("vosk.Close: recognizers still in use, not freeing them")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		resets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.New("vosk.Close: recognizers still resetting, not freeing them")
+	}
+	recsmu.Lock()
+	defer recsmu.Unlock()
+	if len(models) == 0 {
+		return nil
+	}
+	for _, lm := range models {
+		freeRecs(lm.model, lm.recs())
+	}
+	models = nil
+	slog.Info("vosk recognizers and models freed")
+	return nil
+}
+
+func poolSize() int {
+	recsmu.Lock()
+	defer recsmu.Unlock()
+	var n int
+	for _, lm := range models {
+		n += len(lm.gpRecs) + len(lm.grmRecs)
 	}
-	fmt.Println("Vosk test successful! (Took " + fmt.Sprint(tTime) + ")")
+	return n
+}
 
+func poolInUse() int {
+	recsmu.Lock()
+	defer recsmu.Unlock()
+	var n int
+	for _, lm := range models {
+		for _, rec := range lm.recs() {
+			if rec.InUse {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func grammerEnabled() bool {
+	recsmu.Lock()
+	defer recsmu.Unlock()
+	return GrammerEnable
+}
+
+// frees recognizers and the model they were made from
+func freeRecs(m *vosk.VoskModel, recs []*ARec) {
+	for _, rec := range recs {
+		rec.Rec.Free()
+	}
+	m.Free()
+}
+
+// frees a model replaced by a reload, once the requests that were using it are done
+func freeWhenIdle(m *vosk.VoskModel, recs []*ARec) {
+	for {
+		recsmu.Lock()
+		var busy bool
+		for _, rec := range recs {
+			if rec.InUse {
+				busy = true
+				break
+			}
+		}
+		recsmu.Unlock()
+		if !busy {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	resets.Wait()
+	freeRecs(m, recs)
+	slog.Info("old vosk model freed")
 }
 
-func getRec(withGrm bool) (*vosk.VoskRecognizer, int) {
+// a free recognizer for language, the default language's if it isn't loaded
+func getRec(language string, withGrm bool) *ARec {
 	for attempts := 0; attempts < 10; attempts++ {
 		recsmu.Lock()
+		lm := modelFor(language)
+		recs := lm.gpRecs
 		if withGrm && GrammerEnable {
-			for ind, rec := range grmRecs {
-				if !rec.InUse {
-					grmRecs[ind].InUse = true
-					recsmu.Unlock()
-					return grmRecs[ind].Rec, ind
-				}
-			}
-		} else {
-			for ind, rec := range gpRecs {
-				if !rec.InUse {
-					gpRecs[ind].InUse = true
-					recsmu.Unlock()
-					return gpRecs[ind].Rec, ind
-				}
+			recs = lm.grmRecs
+		}
+		for _, rec := range recs {
+			if !rec.InUse {
+				rec.InUse = true
+				recsmu.Unlock()
+				return rec
 			}
 		}
 		recsmu.Unlock()
 		runtime.Gosched()
 		time.Sleep(10 * time.Millisecond)
 	}
-	fmt.Println("All recognizers busy, creating temporary recognizer")
-	var newrec ARec
+	slog.Warn("all vosk recognizers busy, creating temporary recognizer")
+	metrics.STTPoolOverflow.WithLabelValues(Name).Inc()
+	// under the lock, so a reload can't swap the model out while a recognizer is made from it
+	recsmu.Lock()
+	defer recsmu.Unlock()
+	lm := modelFor(language)
+	withGrm = withGrm && GrammerEnable
 	var newRec *vosk.VoskRecognizer
 	var err error
-	newrec.InUse = true
 	if withGrm {
-		newRec, err = vosk.NewRecognizerGrm(model, 16000.0, Grammer)
+		newRec, err = vosk.NewRecognizerGrm(lm.model, 16000.0, Grammer)
 	} else {
-		newRec, err = vosk.NewRecognizer(model, 16000.0)
+		newRec, err = vosk.NewRecognizer(lm.model, 16000.0)
 	}
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to create vosk recognizer", "error", err)
+		os.Exit(1)
 	}
-	newrec.Rec = newRec
-	recsmu.Lock()
-	defer recsmu.Unlock()
+	rec := &ARec{InUse: true, Rec: newRec}
 	if withGrm {
-		grmRecs = append(grmRecs, newrec)
-		return grmRecs[len(grmRecs)-1].Rec, len(grmRecs) - 1
+		lm.grmRecs = append(lm.grmRecs, rec)
 	} else {
-		gpRecs = append(gpRecs, newrec)
-		return gpRecs[len(gpRecs)-1].Rec, len(gpRecs) - 1
+		lm.gpRecs = append(lm.gpRecs, rec)
+	}
+	return rec
+}
+
+// called with recsmu held
+func modelFor(language string) *langModel {
+	if lm, ok := models[language]; ok {
+		return lm
 	}
+	return models[defaultLanguage]
 }
 
 func STT(req sr.SpeechRequest) (string, error) {
-	fmt.Println("(Bot " + req.Device + ", Vosk) Processing...")
 	var withGrm bool
-	if (vars.APIConfig.Knowledge.IntentGraph || req.IsKG) || !GrammerEnable {
-		fmt.Println("Using general recognizer")
+	if (vars.Config().Knowledge.IntentGraph || req.IsKG) || !grammerEnabled() {
 		withGrm = false
 	} else {
-		fmt.Println("Using grammer-optimized recognizer")
 		withGrm = true
 	}
-	rec, recind := getRec(withGrm)
+	req.Log().Debug("vosk processing", "grammer", withGrm, "language", req.Language)
+	_, waitSpan := otel.Tracer("cavalier").Start(req.Context(), "vosk.recognizer_wait")
+	arec := getRec(req.Language, withGrm)
+	rec := arec.Rec
+	waitSpan.End()
 	defer func() {
+		// counted before it's handed back, so nothing frees it between the two
 		recsmu.Lock()
-		if withGrm {
-			grmRecs[recind].InUse = false
-		} else {
-			gpRecs[recind].InUse = false
-		}
+		resets.Add(1)
+		arec.InUse = false
 		recsmu.Unlock()
-		go rec.Reset()
+		go func() {
+			defer resets.Done()
+			rec.Reset()
+		}()
 	}()
-	
+
+	// streaming, VAD and decoding all happen chunk by chunk, so they share a span
+	_, span := otel.Tracer("cavalier").Start(req.Context(), "vosk.stream", trace.WithAttributes(attribute.Bool("vosk.grammer", withGrm)))
+	defer span.End()
 	rec.SetWords(0)
-	
+
 	rec.AcceptWaveform(req.FirstReq)
 	req.DetectEndOfSpeech()
-	
+
 	var lastPartial string
 	var stableCount int
-	
+
 	for {
 		chunk, err := req.GetNextStreamChunk()
 		if err != nil {
+			tracing.RecordError(span, err)
 			return "", err
 		}
 		speechIsDone, doProcess := req.DetectEndOfSpeech()
 		if doProcess {
 			rec.AcceptWaveform(chunk)
-			
+
 			var partialRes map[string]interface{}
 			json.Unmarshal([]byte(rec.PartialResult()), &partialRes)
 			if partial, ok := partialRes["partial"].(string); ok {
@@ -248,6 +406,6 @@ func STT(req sr.SpeechRequest) (string, error) {
 	var jres map[string]interface{}
 	json.Unmarshal([]byte(rec.FinalResult()), &jres)
 	transcribedText := jres["text"].(string)
-	fmt.Println("Bot " + req.Device + " Transcribed text: " + transcribedText)
+	req.Log().Debug("vosk transcribed text", "text", transcribedText)
 	return transcribedText, nil
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package vtt
 
 import (
+	"context"
 	"time"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -12,9 +13,14 @@ type IntentRequest struct {
 	Stream     pb.ChipperGrpc_StreamingIntentServer
 	Device     string
 	Session    string
+	RequestID  string
+	Ctx        context.Context
 	LangString string
 	FirstReq   *pb.StreamingIntentRequest
 	AudioCodec pb.AudioEncoding
+	Mode       pb.RobotMode
+	// set by ttr.IntentPass once an intent has been sent
+	Result *pb.IntentResult
 }
 
 // IntentResponse is the response type VTT intent processors
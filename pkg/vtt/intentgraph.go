@@ -1,6 +1,7 @@
 package vtt
 
 import (
+	"context"
 	"time"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -12,12 +13,14 @@ type IntentGraphRequest struct {
 	Stream     pb.ChipperGrpc_StreamingIntentGraphServer
 	Device     string
 	Session    string
+	RequestID  string
+	Ctx        context.Context
 	LangString string
 	FirstReq   *pb.StreamingIntentGraphRequest
 	AudioCodec pb.AudioEncoding
-
-	// KnowledgeGraph specific
-	Mode pb.RobotMode
+	Mode       pb.RobotMode
+	// set by ttr.IntentPass once an intent has been sent
+	Result *pb.IntentResult
 }
 
 // IntentGraphResponse is the response type VTT intent processors
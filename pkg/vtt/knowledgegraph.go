@@ -1,6 +1,7 @@
 package vtt
 
 import (
+	"context"
 	"time"
 
 	pb "github.com/digital-dream-labs/api/go/chipperpb"
@@ -12,6 +13,8 @@ type KnowledgeGraphRequest struct {
 	Stream     pb.ChipperGrpc_StreamingKnowledgeGraphServer
 	Device     string
 	Session    string
+	RequestID  string
+	Ctx        context.Context
 	LangString string
 	FirstReq   *pb.StreamingKnowledgeGraphRequest
 	Mode       pb.RobotMode
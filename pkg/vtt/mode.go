@@ -0,0 +1,10 @@
+package vtt
+
+import pb "github.com/digital-dream-labs/api/go/chipperpb"
+
+// KnowledgeAllowed reports whether a request in this mode may fall back to the knowledge graph.
+// Only plain voice commands do. In GAME mode (and any mode newer firmware adds, like a prompt mode)
+// the robot is waiting for an answer to its own question, so an unmatched utterance stays unmatched.
+func KnowledgeAllowed(mode pb.RobotMode) bool {
+	return mode == pb.RobotMode_VOICE_COMMAND
+}
@@ -0,0 +1,24 @@
+package vtt
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/digital-dream-labs/api/go/chipperpb"
+)
+
+// TextIntentRequest is the request type for text intent processors.
+// There is no stream to send on, so the matched intent is stored in Response instead.
+type TextIntentRequest struct {
+	Time       time.Time
+	Device     string
+	Session    string
+	RequestID  string
+	Ctx        context.Context
+	LangString string
+	Text       string
+	FirstReq   *pb.TextRequest
+	Mode       pb.RobotMode
+
+	Response *pb.IntentResponse
+}
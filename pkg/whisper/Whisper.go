@@ -1,31 +1,94 @@
 package whisper
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"cavalier/pkg/health"
+	"cavalier/pkg/metrics"
+	"cavalier/pkg/shutdown"
 	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/tracing"
 
 	"cavalier/pkg/vars"
 
 	whisper "github.com/kercre123/whisper.cpp/bindings/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Name string = "whisper.cpp"
 
-const numContexts = 2
-
 type whisperContext struct {
 	ctx    *whisper.Context
 	params whisper.Params
 }
 
-var contextPool chan *whisperContext
+// what a pool was loaded with, from the whisper config section
+type settings struct {
+	model    string
+	contexts int
+	threads  int
+	sampling whisper.SamplingStrategy
+	beamSize int
+}
+
+func settingsOf(c *vars.APIConfig) settings {
+	s := settings{
+		model:    modelPath(c.Whisper.Model),
+		contexts: c.Whisper.Contexts,
+		threads:  c.Whisper.Threads,
+		sampling: whisper.SAMPLING_GREEDY,
+		beamSize: c.Whisper.BeamSize,
+	}
+	if s.threads == 0 {
+		s.threads = runtime.NumCPU()
+	}
+	if c.Whisper.Sampling == "beam_search" {
+		s.sampling = whisper.SAMPLING_BEAM_SEARCH
+	}
+	return s
+}
+
+// a model file, or a name like base.en as whisper.cpp's download script names them
+func modelPath(model string) string {
+	if strings.ContainsRune(model, filepath.Separator) || strings.HasSuffix(model, ".bin") {
+		return model
+	}
+	return filepath.Join("./whisper", "ggml-"+model+".bin")
+}
+
+type contextPool struct {
+	contexts chan *whisperContext
+	settings settings
+}
+
+// replaced whole by a reload. requests give their context back to the pool they took it from
+var (
+	poolMu sync.Mutex
+	pool   *contextPool
+)
+
+func currentPool() *contextPool {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	return pool
+}
+
+var registerClose sync.Once
 
 func padPCM(data []byte) []byte {
 	const sampleRate = 16000
@@ -39,72 +102,138 @@ func padPCM(data []byte) []byte {
 		return data
 	}
 
-	fmt.Println("Padding audio data to be 1000ms")
-
 	paddingSamples := minDurationSamples - currentSamples
 	paddingBytes := make([]byte, paddingSamples*bytesPerSample)
 
 	return append(data, paddingBytes...)
 }
 
-func makeContext(modelPath string, sttLanguage string) (*whisperContext, error) {
-	ctx := whisper.Whisper_init(modelPath)
+func makeContext(s settings, sttLanguage string) (*whisperContext, error) {
+	ctx := whisper.Whisper_init(s.model)
 	if ctx == nil {
 		return nil, fmt.Errorf("failed to initialize whisper context")
 	}
-	params := ctx.Whisper_full_default_params(whisper.SamplingStrategy(whisper.SAMPLING_GREEDY))
+	params := ctx.Whisper_full_default_params(s.sampling)
 	params.SetTranslate(false)
 	params.SetPrintSpecial(false)
 	params.SetPrintProgress(false)
 	params.SetPrintRealtime(false)
 	params.SetPrintTimestamps(false)
-	params.SetThreads(runtime.NumCPU())
+	params.SetThreads(s.threads)
 	params.SetNoContext(true)
 	params.SetSingleSegment(true)
+	if s.sampling == whisper.SAMPLING_BEAM_SEARCH {
+		params.SetBeamSize(s.beamSize)
+	}
 	params.SetLanguage(ctx.Whisper_lang_id(sttLanguage))
 	return &whisperContext{ctx: ctx, params: params}, nil
 }
 
-func Init() error {
-	whispModel := os.Getenv("WHISPER_MODEL")
-	if whispModel == "" {
-		fmt.Println("WHISPER_MODEL not defined, assuming tiny")
-		whispModel = "tiny"
-	} else {
-		whispModel = strings.TrimSpace(whispModel)
-	}
-	var sttLanguage string
-	if len(vars.APIConfig.STT.Language) == 0 {
-		sttLanguage = "en"
-	} else {
-		sttLanguage = strings.Split(vars.APIConfig.STT.Language, "-")[0]
+// Init loads the contexts the whisper config asks for. on a reload the old pool keeps serving
+// until the new one is ready, and if the whisper settings didn't change it's kept as it is
+// (languages are picked per request)
+func Init(c *vars.APIConfig) error {
+	s := settingsOf(c)
+	if running := currentPool(); running != nil && running.settings == s {
+		slog.Info("whisper settings unchanged, keeping the loaded contexts")
+		return nil
 	}
+	sttLanguage := whisperLanguage(c.STT.Language)
 
-	modelPath := filepath.Join("./whisper", "ggml.bin")
-	if _, err := os.Stat(modelPath); err != nil {
-		fmt.Println("Model does not exist: " + modelPath)
+	if _, err := os.Stat(s.model); err != nil {
+		slog.Error("whisper model does not exist", "path", s.model)
 		return err
 	}
-	fmt.Println("Opening Whisper model (%s), creating %d contexts\n", modelPath, numContexts)
+	slog.Info("opening whisper model", "path", s.model, "contexts", s.contexts, "threads", s.threads,
+		"sampling", c.Whisper.Sampling, "beam_size", s.beamSize)
 
-	contextPool = make(chan *whisperContext, numContexts)
-	for i := 0; i < numContexts; i++ {
-		wc, err := makeContext(modelPath, sttLanguage)
+	newPool := &contextPool{contexts: make(chan *whisperContext, s.contexts), settings: s}
+	for i := 0; i < s.contexts; i++ {
+		wc, err := makeContext(s, sttLanguage)
 		if err != nil {
+			freePool(newPool.contexts, i)
 			return err
 		}
-		contextPool <- wc
-		fmt.Printf("Created whisper context %d/%d\n", i+1, numContexts)
+		if i == 0 && wc.ctx.Whisper_is_multilingual() == 0 && slices.ContainsFunc(vars.LanguagesOf(c), notEnglish) {
+			slog.Warn("the whisper model is English only, other languages will be transcribed as English", "path", s.model)
+		}
+		newPool.contexts <- wc
+		slog.Debug("created whisper context", "n", i+1, "of", s.contexts)
 	}
+	poolMu.Lock()
+	old := pool
+	pool = newPool
+	poolMu.Unlock()
+	if old != nil {
+		slog.Info("freeing the old whisper contexts once their requests finish", "path", old.settings.model)
+		go freePool(old.contexts, old.settings.contexts)
+	}
+	metrics.RegisterSTTPool(Name, poolSize, poolInUse)
+	health.Register("stt", func(ctx context.Context) error {
+		if p := currentPool(); p == nil || cap(p.contexts) == 0 {
+			return errors.New("no whisper contexts loaded")
+		}
+		return nil
+	})
+	registerClose.Do(func() { shutdown.Register("whisper", Close) })
 
 	return nil
 }
 
+func notEnglish(language string) bool {
+	return whisperLanguage(language) != "en"
+}
+
+func poolSize() int {
+	if p := currentPool(); p != nil {
+		return cap(p.contexts)
+	}
+	return 0
+}
+
+func poolInUse() int {
+	if p := currentPool(); p != nil {
+		return cap(p.contexts) - len(p.contexts)
+	}
+	return 0
+}
+
+// frees n contexts from pool as they come back
+func freePool(pool chan *whisperContext, n int) {
+	for i := 0; i < n; i++ {
+		wc := <-pool
+		wc.ctx.Whisper_free()
+	}
+}
+
+// Close frees the whisper contexts once they're all back in the pool. if some are still
+// decoding when ctx is done, those are left alone
+func Close(ctx context.Context) error {
+	p := currentPool()
+	if p == nil {
+		return nil
+	}
+	n := cap(p.contexts)
+	for i := 0; i < n; i++ {
+		select {
+		case wc := <-p.contexts:
+			wc.ctx.Whisper_free()
+		case <-ctx.Done():
+			return errors.New("whisper.Close: " + strconv.Itoa(n-i) + " contexts still in use, not freeing them")
+		}
+	}
+	slog.Info("whisper contexts freed")
+	return nil
+}
+
 func STT(req sr.SpeechRequest) (string, error) {
-	fmt.Println("(Bot " + req.Device + ", Whisper) Processing...")
+	req.Log().Debug("whisper processing", "language", req.Language)
+	_, span := otel.Tracer("cavalier").Start(req.Context(), "whisper.stream")
 	for {
 		_, err := req.GetNextStreamChunk()
 		if err != nil {
+			tracing.RecordError(span, err)
+			span.End()
 			return "", err
 		}
 		// has to be split into 320 []byte chunks for VAD
@@ -113,26 +242,88 @@ func STT(req sr.SpeechRequest) (string, error) {
 			break
 		}
 	}
-	transcribedText, err := process(BytesToFloat32Buffer(padPCM(req.DecodedMicData)))
+	span.End()
+	transcribedText, err := process(req.Context(), req.Log(), BytesToFloat32Buffer(padPCM(req.DecodedMicData)), req.Language)
 	if err != nil {
 		return "", err
 	}
 	transcribedText = strings.ToLower(transcribedText)
-	fmt.Println("Bot " + req.Device + " Transcribed text: " + transcribedText)
+	req.Log().Debug("whisper transcribed text", "text", transcribedText)
 	return transcribedText, nil
 }
 
-func process(data []float32) (string, error) {
-	wc := <-contextPool
-	defer func() { contextPool <- wc }()
+// whisper's language code for an STT language, en for en-US. one model covers every language it
+// knows, so the language is set per request rather than per model
+func whisperLanguage(language string) string {
+	if language == "" {
+		return "en"
+	}
+	return strings.Split(language, "-")[0]
+}
 
+func process(ctx context.Context, log *slog.Logger, data []float32, language string) (string, error) {
+	p := currentPool()
+	if p == nil {
+		return "", errors.New("whisper: no contexts loaded")
+	}
+	wc, err := p.get(ctx, log)
+	if err != nil {
+		return "", err
+	}
+	defer func() { p.contexts <- wc }()
+
+	_, span := otel.Tracer("cavalier").Start(ctx, "whisper.decode", trace.WithAttributes(attribute.Int("whisper.samples", len(data))))
+	defer span.End()
+	// the context is ours until it goes back in the pool, so its params can be changed
+	if language == "" {
+		language = vars.Languages()[0]
+	}
+	if id := wc.ctx.Whisper_lang_id(whisperLanguage(language)); id >= 0 {
+		wc.params.SetLanguage(id)
+	}
 	var transcribedText string
-	wc.ctx.Whisper_full(wc.params, data, nil, func(_ int) {
+	err = wc.ctx.Whisper_full(wc.params, data, nil, func(_ int) {
 		transcribedText = strings.TrimSpace(wc.ctx.Whisper_full_get_segment_text(0))
 	}, nil)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return "", errors.New("whisper: " + err.Error())
+	}
 	return transcribedText, nil
 }
 
+// a free context. if they're all decoding, it waits until one is given back, the robot hangs
+// up (no point decoding then) or whisper.pool_timeout_ms passes
+func (p *contextPool) get(ctx context.Context, log *slog.Logger) (*whisperContext, error) {
+	waitStart := time.Now()
+	_, waitSpan := otel.Tracer("cavalier").Start(ctx, "whisper.pool_wait")
+	defer waitSpan.End()
+	select {
+	case wc := <-p.contexts:
+		metrics.STTPoolWait.WithLabelValues(Name).Observe(time.Since(waitStart).Seconds())
+		return wc, nil
+	default:
+	}
+	metrics.STTPoolOverflow.WithLabelValues(Name).Inc()
+	log.Warn("all whisper contexts busy, waiting for one", "contexts", cap(p.contexts))
+	timeout := time.Duration(vars.Config().Whisper.PoolTimeout) * time.Millisecond
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case wc := <-p.contexts:
+		metrics.STTPoolWait.WithLabelValues(Name).Observe(time.Since(waitStart).Seconds())
+		return wc, nil
+	case <-ctx.Done():
+		tracing.RecordError(waitSpan, ctx.Err())
+		return nil, ctx.Err()
+	case <-timer.C:
+		metrics.STTPoolTimeouts.WithLabelValues(Name).Inc()
+		err := errors.New("whisper: no free context after " + timeout.String() + ", raise whisper.contexts")
+		tracing.RecordError(waitSpan, err)
+		return nil, err
+	}
+}
+
 func BytesToFloat32Buffer(buf []byte) []float32 {
 	newB := make([]float32, len(buf)/2)
 	factor := math.Pow(2, float64(16)-1)
@@ -0,0 +1,23 @@
+package whisper
+
+import (
+	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/stt"
+	"cavalier/pkg/vars"
+)
+
+type engine struct{}
+
+func init() {
+	stt.Register(engine{})
+}
+
+func (engine) Name() string { return Name }
+
+func (engine) Capabilities() stt.Capabilities {
+	return stt.Capabilities{Local: true, Multilingual: true, Formatted: true}
+}
+
+func (engine) Init(c *vars.APIConfig) error { return Init(c) }
+
+func (engine) STT(req sr.SpeechRequest) (string, error) { return STT(req) }
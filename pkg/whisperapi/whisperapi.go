@@ -0,0 +1,181 @@
+package whisperapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cavalier/pkg/metrics"
+	"cavalier/pkg/recording"
+	sr "cavalier/pkg/speechrequest"
+	"cavalier/pkg/tracing"
+	"cavalier/pkg/vars"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// transcribes with an OpenAI-compatible /audio/transcriptions endpoint: OpenAI itself, or a
+// local server like whisper.cpp's or faster-whisper's. settings are read per request, so a
+// reload applies to the next one
+
+var Name string = "whisper-api"
+
+var client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// the first retry waits this long, each one after twice as long as the last
+const retryBackoff = 250 * time.Millisecond
+
+type transcription struct {
+	Text string `json:"text"`
+}
+
+type apiError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// a failed attempt, and whether trying again could help
+type attemptError struct {
+	err       error
+	retryable bool
+}
+
+func (e *attemptError) Error() string { return e.err.Error() }
+
+func Init(config *vars.APIConfig) error {
+	c := config.WhisperAPI
+	slog.Info("transcribing with a whisper api", "url", c.BaseURL, "model", c.Model, "timeout_ms", c.Timeout,
+		"retries", c.Retries, "key", c.Key != "")
+	return nil
+}
+
+func STT(req sr.SpeechRequest) (string, error) {
+	req.Log().Debug("whisper api processing", "language", req.Language)
+	_, span := otel.Tracer("cavalier").Start(req.Context(), "whisper_api.stream")
+	for {
+		_, err := req.GetNextStreamChunk()
+		if err != nil {
+			tracing.RecordError(span, err)
+			span.End()
+			return "", err
+		}
+		speechIsDone, _ := req.DetectEndOfSpeech()
+		if speechIsDone {
+			break
+		}
+	}
+	span.End()
+	transcribedText, err := transcribe(req.Context(), req.Log(), recording.WAVBytes(req.DecodedMicData), req.Language)
+	if err != nil {
+		if req.Context().Err() == nil {
+			metrics.ProviderErrors.WithLabelValues(Name).Inc()
+		}
+		return "", err
+	}
+	transcribedText = strings.ToLower(strings.TrimSpace(transcribedText))
+	req.Log().Debug("whisper api transcribed text", "text", transcribedText)
+	return transcribedText, nil
+}
+
+// posts wav, trying again on errors that might go away
+func transcribe(ctx context.Context, log *slog.Logger, wav []byte, language string) (string, error) {
+	c := vars.Config().WhisperAPI
+	if c.Language != "" {
+		language = c.Language
+	} else if language != "" {
+		// the API wants ISO-639-1, en rather than en-US
+		language, _, _ = strings.Cut(language, "-")
+	}
+	ctx, span := otel.Tracer("cavalier").Start(ctx, "whisper_api.transcribe", trace.WithAttributes(attribute.String("whisper_api.model", c.Model)))
+	defer span.End()
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		text, err := post(ctx, c.BaseURL, c.Key, c.Model, language, c.Prompt, time.Duration(c.Timeout)*time.Millisecond, wav)
+		if err == nil {
+			return text, nil
+		}
+		var failed *attemptError
+		if !errors.As(err, &failed) || !failed.retryable || attempt >= c.Retries || ctx.Err() != nil {
+			tracing.RecordError(span, err)
+			return "", errors.New("whisperapi: " + err.Error())
+		}
+		log.Warn("whisper api request failed, retrying", "attempt", attempt+1, "of", c.Retries+1, "error", err)
+		select {
+		case <-ctx.Done():
+			tracing.RecordError(span, ctx.Err())
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func post(ctx context.Context, baseURL, key, model, language, prompt string, timeout time.Duration, wav []byte) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	file, err := w.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	file.Write(wav)
+	w.WriteField("model", model)
+	w.WriteField("response_format", "json")
+	if language != "" {
+		w.WriteField("language", language)
+	}
+	if prompt != "" {
+		w.WriteField("prompt", prompt)
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", w.FormDataContentType())
+	if key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		// a timeout or a network error. one where the robot hung up isn't worth retrying, the
+		// caller checks for that
+		return "", &attemptError{err: err, retryable: true}
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", &attemptError{err: err, retryable: true}
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(respBody))
+		var apiErr apiError
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		err := errors.New(strconv.Itoa(resp.StatusCode) + " from the server: " + msg)
+		return "", &attemptError{err: err, retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500}
+	}
+	var t transcription
+	if err := json.Unmarshal(respBody, &t); err != nil {
+		return "", errors.New("unexpected response: " + err.Error())
+	}
+	return t.Text, nil
+}
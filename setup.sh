@@ -171,7 +171,13 @@ function buildCavalier() {
         export CGO_CFLAGS="-I$(pwd)/vosklib"
         export CGO_LDFLAGS="-L$(pwd)/vosklib -lvosk -ldl -lpthread"
     fi
-    go build -ldflags "-w -s" -tags "nolibopusfile" -o cavalier cmd/${sttService}/main.go
+    # the engine that wasn't set up is left out, its library isn't there to link against
+    if [[ $sttService == "whisper" ]]; then
+        buildTags="nolibopusfile novosk"
+    else
+        buildTags="nolibopusfile nowhisper"
+    fi
+    go build -ldflags "-w -s" -tags "${buildTags}" -o cavalier ./cmd/cavalier
     echo
     echo "cavalier has been compiled."
 }